@@ -5,6 +5,7 @@ go 1.15
 require (
 	github.com/agnivade/levenshtein v1.1.1 // indirect
 	github.com/buidl-labs/celo-voting-validator-backend v0.0.0-20210531120614-c134fec4e94b
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1
 	github.com/go-chi/chi v4.1.2+incompatible // indirect
 	github.com/go-pg/pg/extra/pgdebug v0.2.0
 	github.com/go-pg/pg/v10 v10.9.3
@@ -16,6 +17,6 @@ require (
 	github.com/rs/cors v1.7.0 // indirect
 	github.com/vektah/gqlparser/v2 v2.2.0 // indirect
 	github.com/vmihailenco/msgpack/v5 v5.3.4 // indirect
-	golang.org/x/crypto v0.0.0-20210513164829-c07d793c2f9a // indirect
+	golang.org/x/crypto v0.0.0-20210513164829-c07d793c2f9a
 	golang.org/x/sys v0.0.0-20210531080801-fdfd190a6549 // indirect
 )
@@ -0,0 +1,158 @@
+package indexer
+
+import (
+	"context"
+	"strings"
+
+	"github.com/buidl-labs/celo-voting-validator-backend/graph/model"
+	"github.com/go-pg/pg/v10"
+)
+
+//move is a Validator that's affiliated with another ValidatorGroup than the one it has in the DB.
+type move struct {
+	validator *model.Validator
+	toGroupID string
+	event     *ValidatorMove
+}
+
+//syncAffiliates reconciles the Validators in the DB with the affiliates of `groups` at `epoch`:
+//affiliates that aren't in the DB are inserted, Validators affiliated with another ValidatorGroup than
+//the one they have in the DB are moved to it and the move is recorded as a ValidatorMove, and the
+//Memberships are synced, see `syncMemberships`. A Validator listed by more than one ValidatorGroup only
+//counts as an affiliate of the first one, see `dedupeAffiliates`.
+//
+//Validators that can't be inserted or moved are added to `report`, the rest of the run carries on without them.
+func syncAffiliates(ctx context.Context, DB *pg.DB, epoch uint64, groups []CeloValidatorGroupAndValidatorBasicData, report *Report) error {
+	db := DB.WithContext(ctx)
+	groups = dedupeAffiliates(ctx, groups)
+
+	var groupsFromDB []*model.ValidatorGroup
+	if err := db.Model(&groupsFromDB).Column("id", "address").Select(); err != nil {
+		return persistError("select validator groups", err)
+	}
+	groupIDs := make(map[string]string, len(groupsFromDB))
+	groupAddresses := make(map[string]string, len(groupsFromDB))
+	for _, vg := range groupsFromDB {
+		groupIDs[vg.Address] = vg.ID
+		groupAddresses[vg.ID] = vg.Address
+	}
+
+	var validatorsFromDB []*model.Validator
+	if err := db.Model(&validatorsFromDB).Column("id", "address", "validator_group_id").Select(); err != nil {
+		return persistError("select validators", err)
+	}
+	validators := make(map[string]*model.Validator, len(validatorsFromDB))
+	for _, v := range validatorsFromDB {
+		validators[v.Address] = v
+	}
+
+	newValidators, moves := classifyAffiliates(epoch, groups, groupIDs, groupAddresses, validators)
+
+	errs := insertBatch(db, &newValidators, len(newValidators), func(i int) interface{} { return newValidators[i] })
+	for i, v := range newValidators {
+		if err := errs[i]; err != nil {
+			report.addFailure(ctx, FailureValidator, v.Address, persistError("insert validator", err))
+		}
+	}
+
+	// Moves are rare, each one is applied in its own transaction so that a failed one doesn't hold back the others.
+	moved := 0
+	for _, m := range moves {
+		err := DB.RunInTransaction(ctx, func(tx *pg.Tx) error {
+			_, err := tx.Model((*model.Validator)(nil)).
+				Set("validator_group_id = ?", m.toGroupID).
+				Where("id = ?", m.validator.ID).
+				Update()
+			if err != nil {
+				return err
+			}
+			_, err = tx.Model(m.event).Insert()
+			return err
+		})
+		if err != nil {
+			report.addFailure(ctx, FailureValidator, m.validator.Address, persistError("move validator", err))
+			continue
+		}
+		m.validator.ValidatorGroupId = m.toGroupID
+		moved++
+		Log(ctx).Info("Validator moved", "validator", m.event.ValidatorAddress, "from", m.event.FromGroupAddress, "to", m.event.ToGroupAddress)
+	}
+
+	// Record which Validators joined or left a VG since the last run.
+	err := DB.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		left, err := syncMemberships(tx, epoch, groups)
+		if len(left) > 0 {
+			Log(ctx).Info("Validators left their groups", "validators", strings.Join(left, ","))
+		}
+		return err
+	})
+	if err != nil {
+		return persistError("sync memberships", err)
+	}
+
+	Log(ctx).Info("Synced affiliates", "new_validators", len(newValidators)-len(errs), "moved_validators", moved)
+	return nil
+}
+
+//dedupeAffiliates returns `groups` with every Validator listed once, by the first ValidatorGroup listing it.
+//The affiliates of the ValidatorGroups are fetched page by page, so a Validator moving in the meantime can be
+//listed by both the group it left and the one it joined.
+func dedupeAffiliates(ctx context.Context, groups []CeloValidatorGroupAndValidatorBasicData) []CeloValidatorGroupAndValidatorBasicData {
+	listedBy := make(map[string]string) // Group address, by validator address.
+	deduped := make([]CeloValidatorGroupAndValidatorBasicData, len(groups))
+	for i, vg := range groups {
+		edges := vg.Affiliates.Edges[:0:0]
+		for _, affiliate := range vg.Affiliates.Edges {
+			if first, ok := listedBy[affiliate.Node.Address]; ok {
+				Log(ctx).Warn("Validator listed by more than one group, keeping the first", "validator", affiliate.Node.Address, "group", first, "ignored_group", vg.Account.Address)
+				continue
+			}
+			listedBy[affiliate.Node.Address] = vg.Account.Address
+			edges = append(edges, affiliate)
+		}
+		deduped[i] = vg
+		deduped[i].Affiliates.Edges = edges
+	}
+	return deduped
+}
+
+//classifyAffiliates returns the affiliates of `groups` that aren't in `validators`, the Validators in the DB by address,
+//and the moves of the ones in another ValidatorGroup than the one they have in the DB. `groupIDs` and `groupAddresses`
+//map the ValidatorGroups in the DB between addresses and IDs, affiliates of ValidatorGroups that aren't in the DB are skipped.
+//Every Validator must be listed once, see `dedupeAffiliates`.
+func classifyAffiliates(epoch uint64, groups []CeloValidatorGroupAndValidatorBasicData, groupIDs, groupAddresses map[string]string, validators map[string]*model.Validator) ([]*model.Validator, []move) {
+	var newValidators []*model.Validator
+	var moves []move
+	for _, vg := range groups {
+		// VGs that couldn't be added to the DB during discovery are already in the report.
+		groupID, ok := groupIDs[vg.Account.Address]
+		if !ok {
+			continue
+		}
+		for _, affiliate := range vg.Affiliates.Edges {
+			v, ok := validators[affiliate.Node.Address]
+			if !ok {
+				newValidators = append(newValidators, &model.Validator{
+					Address:          affiliate.Node.Address,
+					Name:             affiliate.Node.Name,
+					ValidatorGroupId: groupID,
+				})
+				continue
+			}
+			if v.ValidatorGroupId == groupID {
+				continue
+			}
+			moves = append(moves, move{
+				validator: v,
+				toGroupID: groupID,
+				event: &ValidatorMove{
+					ValidatorAddress: v.Address,
+					FromGroupAddress: groupAddresses[v.ValidatorGroupId],
+					ToGroupAddress:   vg.Account.Address,
+					Epoch:            epoch,
+				},
+			})
+		}
+	}
+	return newValidators, moves
+}
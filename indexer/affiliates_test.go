@@ -0,0 +1,132 @@
+package indexer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/buidl-labs/celo-voting-validator-backend/graph/model"
+)
+
+func TestDedupeAffiliates(t *testing.T) {
+	groups := groupsOf(t, map[string][]string{
+		"0xgroup1": {"0xvalidator1", "0xvalidator2"},
+		"0xgroup2": {"0xvalidator2", "0xvalidator3"},
+		"0xgroup3": {"0xvalidator3", "0xvalidator3"},
+	})
+	deduped := dedupeAffiliates(context.Background(), groups)
+
+	got := make(map[string][]string)
+	for _, vg := range deduped {
+		got[vg.Account.Address] = []string{}
+		for _, affiliate := range vg.Affiliates.Edges {
+			got[vg.Account.Address] = append(got[vg.Account.Address], affiliate.Node.Address)
+		}
+	}
+	want := map[string][]string{
+		"0xgroup1": {"0xvalidator1", "0xvalidator2"},
+		"0xgroup2": {"0xvalidator3"},
+		"0xgroup3": {},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("dedupeAffiliates() = %v, want %v", got, want)
+	}
+	if len(groups[1].Affiliates.Edges) != 2 {
+		t.Errorf("dedupeAffiliates() changed the affiliates it was given")
+	}
+}
+
+func TestClassifyAffiliates(t *testing.T) {
+	groupIDs := map[string]string{"0xgroup1": "id-group1", "0xgroup2": "id-group2", "0xgroup3": "id-group3"}
+	groupAddresses := map[string]string{"id-group1": "0xgroup1", "id-group2": "0xgroup2", "id-group3": "0xgroup3"}
+
+	tests := []struct {
+		name       string
+		affiliates map[string][]string
+		inDB       map[string]string // Group address, by validator address.
+		new        map[string]string // Group ID, by validator address.
+		moves      []ValidatorMove
+	}{
+		{
+			name:       "unchanged",
+			affiliates: map[string][]string{"0xgroup1": {"0xvalidator1"}},
+			inDB:       map[string]string{"0xvalidator1": "0xgroup1"},
+		},
+		{
+			name:       "new",
+			affiliates: map[string][]string{"0xgroup1": {"0xvalidator1", "0xvalidator2"}},
+			inDB:       map[string]string{"0xvalidator1": "0xgroup1"},
+			new:        map[string]string{"0xvalidator2": "id-group1"},
+		},
+		{
+			name:       "move",
+			affiliates: map[string][]string{"0xgroup1": {"0xvalidator1"}, "0xgroup2": {"0xvalidator2"}},
+			inDB:       map[string]string{"0xvalidator1": "0xgroup1", "0xvalidator2": "0xgroup1"},
+			moves:      []ValidatorMove{{ValidatorAddress: "0xvalidator2", FromGroupAddress: "0xgroup1", ToGroupAddress: "0xgroup2", Epoch: 7}},
+		},
+		{
+			name:       "swap",
+			affiliates: map[string][]string{"0xgroup1": {"0xvalidator2"}, "0xgroup2": {"0xvalidator1"}},
+			inDB:       map[string]string{"0xvalidator1": "0xgroup1", "0xvalidator2": "0xgroup2"},
+			moves: []ValidatorMove{
+				{ValidatorAddress: "0xvalidator2", FromGroupAddress: "0xgroup2", ToGroupAddress: "0xgroup1", Epoch: 7},
+				{ValidatorAddress: "0xvalidator1", FromGroupAddress: "0xgroup1", ToGroupAddress: "0xgroup2", Epoch: 7},
+			},
+		},
+		{
+			name:       "group not in the DB",
+			affiliates: map[string][]string{"0xgroup4": {"0xvalidator1", "0xvalidator2"}},
+			inDB:       map[string]string{"0xvalidator1": "0xgroup1"},
+		},
+		// Listed by two groups in one response, a new Validator is inserted once, and not moved as well.
+		{
+			name:       "new, listed twice",
+			affiliates: map[string][]string{"0xgroup1": {"0xvalidator1"}, "0xgroup2": {"0xvalidator1"}},
+			new:        map[string]string{"0xvalidator1": "id-group1"},
+		},
+		// A Validator listed by its group and another one stays where it is.
+		{
+			name:       "listed twice, first by its group",
+			affiliates: map[string][]string{"0xgroup1": {"0xvalidator1"}, "0xgroup2": {"0xvalidator1"}},
+			inDB:       map[string]string{"0xvalidator1": "0xgroup1"},
+		},
+		{
+			name:       "moved, listed twice",
+			affiliates: map[string][]string{"0xgroup2": {"0xvalidator1"}, "0xgroup3": {"0xvalidator1"}},
+			inDB:       map[string]string{"0xvalidator1": "0xgroup1"},
+			moves:      []ValidatorMove{{ValidatorAddress: "0xvalidator1", FromGroupAddress: "0xgroup1", ToGroupAddress: "0xgroup2", Epoch: 7}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validators := make(map[string]*model.Validator)
+			for address, group := range tt.inDB {
+				validators[address] = &model.Validator{ID: "id-" + address, Address: address, ValidatorGroupId: groupIDs[group]}
+			}
+			groups := dedupeAffiliates(context.Background(), groupsOf(t, tt.affiliates))
+			newValidators, moves := classifyAffiliates(7, groups, groupIDs, groupAddresses, validators)
+
+			var gotNew map[string]string
+			for _, v := range newValidators {
+				if gotNew == nil {
+					gotNew = make(map[string]string)
+				}
+				gotNew[v.Address] = v.ValidatorGroupId
+			}
+			if !reflect.DeepEqual(gotNew, tt.new) {
+				t.Errorf("new validators = %v, want %v", gotNew, tt.new)
+			}
+
+			var gotMoves []ValidatorMove
+			for _, m := range moves {
+				if m.validator != validators[m.event.ValidatorAddress] || m.toGroupID != groupIDs[m.event.ToGroupAddress] {
+					t.Errorf("move of %s applies to %+v, group %s", m.event.ValidatorAddress, m.validator, m.toGroupID)
+				}
+				gotMoves = append(gotMoves, *m.event)
+			}
+			if !reflect.DeepEqual(gotMoves, tt.moves) {
+				t.Errorf("moves = %+v, want %+v", gotMoves, tt.moves)
+			}
+		})
+	}
+}
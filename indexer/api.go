@@ -2,99 +2,220 @@ package indexer
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"io"
+	"io/ioutil"
 	"net/http"
-	"os"
+	"strings"
 	"time"
 
 	"github.com/machinebox/graphql"
 )
 
-func getDataServiceURL() string {
-	host := os.Getenv("DATA_SERVICE_HOST")
-	return fmt.Sprintf("https://%s.onrender.com", host)
+// Names of the upstream endpoints, used to configure their RetryPolicy.
+const (
+	EndpointCurrentEpoch      = "current-epoch"
+	EndpointDowntimeScore     = "downtime-score"
+	EndpointTargetAPY         = "target-apy"
+	EndpointEpochRegistered   = "epoch-vg-registered"
+	EndpointValidatorGroups   = "validator-groups"
+	EndpointElectedValidators = "elected-validators"
+	EndpointGroupDetails      = "group-details"
+	EndpointAccountMetadata   = "account-metadata"
+)
+
+//maxMetadataSize bounds the size of the metadata of an account, which is served by whoever runs the account.
+const maxMetadataSize = 1 << 20
+
+//ExplorerSource is the ChainSource backed by the Celo explorer's GraphQL API and the data-service HTTP API.
+type ExplorerSource struct {
+	dataService    *dataServiceClient
+	gqlClient      *graphql.Client
+	metadataClient *http.Client
+	endpoints      map[string]*endpoint
+
+	explorerTimeout     time.Duration
+	groupDetailsTimeout time.Duration
+	calendar            EpochCalendar
 }
 
-func findCurrentEpoch(client *http.Client) (uint64, error) {
-	resp, err := client.Get(fmt.Sprintf("%s/current-epoch", getDataServiceURL()))
-	if err != nil {
-		return 0, err
+//NewExplorerSource returns an ExplorerSource using the endpoints and timeouts of `cfg`.
+//Failed calls are retried according to `cfg.Retry`.
+func NewExplorerSource(cfg *Config) (*ExplorerSource, error) {
+	network, ok := cfg.NetworkProfile()
+	if !ok {
+		return nil, fmt.Errorf("explorer: unknown network %q", cfg.Network)
 	}
-	defer resp.Body.Close()
 
-	epoch := new(currentEpoch)
-	json.NewDecoder(resp.Body).Decode(epoch)
-	return epoch.Epoch, nil
+	// The clients see 5xx and 429 responses as errors, so they can be retried.
+	transport := statusTransport{base: http.DefaultTransport}
+	// Metadata URLs are set by the accounts, they mustn't reach the indexer's own network.
+	metadataTransport := statusTransport{base: publicTransport()}
+	s := &ExplorerSource{
+		dataService: &dataServiceClient{
+			httpClient: &http.Client{Timeout: cfg.DataServiceTimeout, Transport: transport},
+			baseURL:    strings.TrimSuffix(cfg.DataServiceURL, "/"),
+		},
+		gqlClient:      graphql.NewClient(cfg.ExplorerURL, graphql.WithHTTPClient(&http.Client{Transport: transport})),
+		metadataClient: &http.Client{Transport: metadataTransport},
+		endpoints:      make(map[string]*endpoint),
+
+		explorerTimeout:     cfg.ExplorerTimeout,
+		groupDetailsTimeout: cfg.GroupDetailsTimeout,
+		calendar:            network.Calendar(),
+	}
+	for _, name := range []string{
+		EndpointCurrentEpoch, EndpointDowntimeScore, EndpointTargetAPY, EndpointEpochRegistered,
+		EndpointValidatorGroups, EndpointElectedValidators, EndpointGroupDetails, EndpointAccountMetadata,
+	} {
+		s.endpoints[name] = newEndpoint(name, cfg.Retry.policy(name))
+	}
+	return s, nil
 }
 
-func getVGSlashingMultiplier(client *http.Client, address string) (string, error) {
-	resp, err := client.Get(fmt.Sprintf("%s/downtime-score/%s", getDataServiceURL(), address))
+func httpGet(ctx context.Context, client *http.Client, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer resp.Body.Close()
+	return client.Do(req)
+}
 
-	multiplier := new(slashingMultiplier)
-	json.NewDecoder(resp.Body).Decode(multiplier)
-	return multiplier.Multiplier, nil
+//runGraphQL runs `req` against the explorer into `resp`, retrying according to the policy of `endpoint`.
+//Each attempt is bounded by `timeout`.
+func (s *ExplorerSource) runGraphQL(ctx context.Context, endpoint string, timeout time.Duration, req *graphql.Request, resp interface{}) error {
+	return s.endpoints[endpoint].do(ctx, func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return s.gqlClient.Run(ctx, req, resp)
+	})
 }
 
-func getTargetAPY(client *http.Client) (string, error) {
-	resp, err := client.Get(fmt.Sprintf("%s/target-apy", getDataServiceURL()))
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
+//CurrentEpoch fetches the epoch the chain is currently in.
+func (s *ExplorerSource) CurrentEpoch(ctx context.Context) (uint64, error) {
+	var epoch uint64
+	err := s.endpoints[EndpointCurrentEpoch].do(ctx, func(ctx context.Context) (err error) {
+		epoch, err = s.dataService.currentEpoch(ctx)
+		return err
+	})
+	return epoch, err
+}
 
-	apy := new(targetApy)
-	json.NewDecoder(resp.Body).Decode(apy)
-	return apy.TargetApy, nil
+//DowntimeScore fetches the slashing multiplier of the ValidatorGroup at `address`.
+func (s *ExplorerSource) DowntimeScore(ctx context.Context, address string) (string, error) {
+	var multiplier string
+	err := s.endpoints[EndpointDowntimeScore].do(ctx, func(ctx context.Context) (err error) {
+		multiplier, err = s.dataService.downtimeScore(ctx, address)
+		return err
+	})
+	return multiplier, err
 }
 
-func getEpochVGRegistered(client *http.Client, address string) (epochVGRegistered, error) {
-	epochRegistered := new(epochVGRegistered)
-	resp, err := client.Get(fmt.Sprintf("%s/epoch-vg-registered/%s", getDataServiceURL(), address))
-	if err != nil {
-		return *epochRegistered, err
-	}
-	defer resp.Body.Close()
+//TargetAPY fetches the target yield set by the network.
+func (s *ExplorerSource) TargetAPY(ctx context.Context) (string, error) {
+	var apy string
+	err := s.endpoints[EndpointTargetAPY].do(ctx, func(ctx context.Context) (err error) {
+		apy, err = s.dataService.targetAPY(ctx)
+		return err
+	})
+	return apy, err
+}
 
-	json.NewDecoder(resp.Body).Decode(epochRegistered)
-	return *epochRegistered, nil
+//EpochRegistered fetches the epoch the ValidatorGroup at `address` registered at.
+func (s *ExplorerSource) EpochRegistered(ctx context.Context, address string) (EpochVGRegistered, error) {
+	var epochRegistered EpochVGRegistered
+	err := s.endpoints[EndpointEpochRegistered].do(ctx, func(ctx context.Context) (err error) {
+		epochRegistered, err = s.dataService.epochRegistered(ctx, address)
+		return err
+	})
+	return epochRegistered, err
 }
 
-func getValidatorGroupsAndValidatorsBasicData(client *graphql.Client) (validatorGroupAndValidatorsBasicData, error) {
-	req := graphql.NewRequest(`{
-	  celoValidatorGroups{
-	    account{
-	      address
-	      name
-	    }
-	    affiliates(first: 10){ 
-	      edges{
-	        node{
-	          name
-	          address
-	        }
-	      }
+//ValidatorGroups fetches every ValidatorGroup along with all of its Validators.
+func (s *ExplorerSource) ValidatorGroups(ctx context.Context) (ValidatorGroupAndValidatorsBasicData, error) {
+	req := graphql.NewRequest(`
+		query($first: Int!){
+			celoValidatorGroups{
+				account{
+					address
+					name
+				}
+				affiliates(first: $first){
+					edges{
+						node{
+							name
+							address
+						}
+					}
+					pageInfo{
+						hasNextPage
+						endCursor
+					}
+				}
 			}
-	  }  
-	}`)
+		}
+	`)
+	req.Var("first", connectionPageSize)
 
-	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(time.Second*30))
-	defer cancel()
-	var resp validatorGroupAndValidatorsBasicData
-	if err := client.Run(ctx, req, &resp); err != nil {
+	var resp ValidatorGroupAndValidatorsBasicData
+	if err := s.runGraphQL(ctx, EndpointValidatorGroups, s.explorerTimeout, req, &resp); err != nil {
 		return resp, err
 	}
+
+	// Only the first page of each connection comes with the VGs, the rest is fetched group by group.
+	for i := range resp.CeloValidatorGroups {
+		vg := &resp.CeloValidatorGroups[i]
+		err := paginate(ctx, vg.Affiliates.PageInfo, func(ctx context.Context, after string) (PageInfo, error) {
+			var page struct {
+				CeloValidatorGroup struct {
+					Affiliates AffiliatesBasicData `json:"affiliates"`
+				} `json:"celoValidatorGroup"`
+			}
+			if err := s.connectionPage(ctx, EndpointValidatorGroups, basicAffiliatesPageQuery, vg.Account.Address, after, &page); err != nil {
+				return PageInfo{}, err
+			}
+			vg.Affiliates.Edges = append(vg.Affiliates.Edges, page.CeloValidatorGroup.Affiliates.Edges...)
+			return page.CeloValidatorGroup.Affiliates.PageInfo, nil
+		})
+		if err != nil {
+			return resp, fmt.Errorf("affiliates of %s: %w", vg.Account.Address, err)
+		}
+	}
 	return resp, nil
 }
 
-func getElectedValidatorsAtEpoch(client *graphql.Client, epoch uint64) (electedValidatorsAtEpoch, error) {
-	const BlocksPerEpoch = 17280
+const basicAffiliatesPageQuery = `
+	query($address: AddressHash!, $first: Int!, $after: String!){
+		celoValidatorGroup(hash: $address){
+			affiliates(first: $first, after: $after){
+				edges{
+					node{
+						name
+						address
+					}
+				}
+				pageInfo{
+					hasNextPage
+					endCursor
+				}
+			}
+		}
+	}
+`
+
+//connectionPage runs `query` against the explorer into `resp`, for the page after the cursor `after` of a
+//connection of the account at `address`. It's retried according to the policy of `endpoint`.
+func (s *ExplorerSource) connectionPage(ctx context.Context, endpoint, query, address, after string, resp interface{}) error {
+	req := graphql.NewRequest(query)
+	req.Var("address", address)
+	req.Var("first", connectionPageSize)
+	req.Var("after", after)
+	return s.runGraphQL(ctx, endpoint, s.explorerTimeout, req, resp)
+}
+
+//ElectedValidatorsAtEpoch fetches the Validators elected in `epoch`.
+func (s *ExplorerSource) ElectedValidatorsAtEpoch(ctx context.Context, epoch uint64) (ElectedValidatorsAtEpoch, error) {
 	req := graphql.NewRequest(`
 		query($block: Int!){ 
 			celoElectedValidators(blockNumber: $block) { 
@@ -109,40 +230,37 @@ func getElectedValidatorsAtEpoch(client *graphql.Client, epoch uint64) (electedV
 			}
 		}
 	`)
-	var blockNumber uint64
-	var resp electedValidatorsAtEpoch
+	var resp ElectedValidatorsAtEpoch
 	if epoch < 1 {
 		return resp, errors.New("error: epoch needs to be greater than or equal to 1")
-	} else if epoch == 1 {
-		blockNumber = BlocksPerEpoch / 2
-	} else {
-		blockNumber = ((epoch - 1) * BlocksPerEpoch) + 500
 	}
+	blockNumber := s.calendar.SampleBlock(epoch)
 	req.Var("block", blockNumber)
-	log.Println("Finding elected validators at block:", blockNumber)
+	Log(ctx).Debug("Finding elected validators", LogEpoch, epoch, "block", blockNumber)
 
-	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(time.Second*30))
-	defer cancel()
-	if err := client.Run(ctx, req, &resp); err != nil {
+	if err := s.runGraphQL(ctx, EndpointElectedValidators, s.explorerTimeout, req, &resp); err != nil {
 		return resp, err
 	}
 
 	return resp, nil
 }
 
-func getValidatorGroupsAndValidatorsDetails(client *graphql.Client) (celoValidatorGroupsAndValidatorsDetails, error) {
-	req := graphql.NewRequest(`{
+//GroupDetails fetches the current stats of every ValidatorGroup and all of its Validators and claims.
+func (s *ExplorerSource) GroupDetails(ctx context.Context) (CeloValidatorGroupsAndValidatorsDetails, error) {
+	req := graphql.NewRequest(`
+		query($first: Int!){
 			celoValidatorGroups {
 				account {
 					address
 					name
+					url
 					group {
 						commission
 						lockedGold
 						receivableVotes
 						votes
 					}
-					claims(first: 10){
+					claims(first: $first){
 						edges{
 							node {
 								element
@@ -150,11 +268,14 @@ func getValidatorGroupsAndValidatorsDetails(client *graphql.Client) (celoValidat
 								verified
 							}
 						}
+						pageInfo {
+							hasNextPage
+							endCursor
+						}
 					}
-		
 				}
 				numMembers
-				affiliates(first: 5) {
+				affiliates(first: $first) {
 					edges {
 						node {
 							lastElected
@@ -162,25 +283,134 @@ func getValidatorGroupsAndValidatorsDetails(client *graphql.Client) (celoValidat
 							address
 							attestationsFulfilled
 							attestationsRequested
-							score
 						}
 					}
+					pageInfo {
+						hasNextPage
+						endCursor
+					}
 				}
 				accumulatedRewards
 				accumulatedActive
 			}
 		}
 		`)
+	req.Var("first", connectionPageSize)
 
-	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(time.Second*90))
-	defer cancel()
-	var resp celoValidatorGroupsAndValidatorsDetails
-	if err := client.Run(ctx, req, &resp); err != nil {
+	var resp CeloValidatorGroupsAndValidatorsDetails
+	if err := s.runGraphQL(ctx, EndpointGroupDetails, s.groupDetailsTimeout, req, &resp); err != nil {
 		return resp, err
 	}
+
+	// Only the first page of each connection comes with the VGs, the rest is fetched group by group.
+	for i := range resp.CeloValidatorGroups {
+		vg := &resp.CeloValidatorGroups[i]
+		err := paginate(ctx, vg.Account.Claims.PageInfo, func(ctx context.Context, after string) (PageInfo, error) {
+			var page struct {
+				CeloAccount struct {
+					Claims ClaimsDetails `json:"claims"`
+				} `json:"celoAccount"`
+			}
+			if err := s.connectionPage(ctx, EndpointGroupDetails, claimsPageQuery, vg.Account.Address, after, &page); err != nil {
+				return PageInfo{}, err
+			}
+			vg.Account.Claims.Edges = append(vg.Account.Claims.Edges, page.CeloAccount.Claims.Edges...)
+			return page.CeloAccount.Claims.PageInfo, nil
+		})
+		if err != nil {
+			return resp, fmt.Errorf("claims of %s: %w", vg.Account.Address, err)
+		}
+
+		err = paginate(ctx, vg.Affiliates.PageInfo, func(ctx context.Context, after string) (PageInfo, error) {
+			var page struct {
+				CeloValidatorGroup struct {
+					Affiliates AffiliatesDetails `json:"affiliates"`
+				} `json:"celoValidatorGroup"`
+			}
+			if err := s.connectionPage(ctx, EndpointGroupDetails, detailedAffiliatesPageQuery, vg.Account.Address, after, &page); err != nil {
+				return PageInfo{}, err
+			}
+			vg.Affiliates.Edges = append(vg.Affiliates.Edges, page.CeloValidatorGroup.Affiliates.Edges...)
+			return page.CeloValidatorGroup.Affiliates.PageInfo, nil
+		})
+		if err != nil {
+			return resp, fmt.Errorf("affiliates of %s: %w", vg.Account.Address, err)
+		}
+	}
 	return resp, nil
 }
 
+const claimsPageQuery = `
+	query($address: AddressHash!, $first: Int!, $after: String!){
+		celoAccount(hash: $address){
+			claims(first: $first, after: $after){
+				edges{
+					node{
+						element
+						type
+						verified
+					}
+				}
+				pageInfo{
+					hasNextPage
+					endCursor
+				}
+			}
+		}
+	}
+`
+
+const detailedAffiliatesPageQuery = `
+	query($address: AddressHash!, $first: Int!, $after: String!){
+		celoValidatorGroup(hash: $address){
+			affiliates(first: $first, after: $after){
+				edges{
+					node{
+						lastElected
+						score
+						address
+						attestationsFulfilled
+						attestationsRequested
+					}
+				}
+				pageInfo{
+					hasNextPage
+					endCursor
+				}
+			}
+		}
+	}
+`
+
+//AccountMetadata fetches the metadata an account published at `url`. Only HTTP(S) URLs are supported.
+func (s *ExplorerSource) AccountMetadata(ctx context.Context, url string) ([]byte, error) {
+	if !isHTTPURL(url) {
+		return nil, fmt.Errorf("unsupported metadata url %q", url)
+	}
+	var metadata []byte
+	err := s.endpoints[EndpointAccountMetadata].do(ctx, func(ctx context.Context) error {
+		resp, err := httpGet(ctx, s.metadataClient, url)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			io.Copy(ioutil.Discard, resp.Body)
+			return &StatusError{Code: resp.StatusCode, URL: url}
+		}
+		metadata, err = ioutil.ReadAll(io.LimitReader(resp.Body, maxMetadataSize+1))
+		if err != nil {
+			return err
+		}
+		if len(metadata) > maxMetadataSize {
+			return fmt.Errorf("%s: metadata larger than %d bytes", url, maxMetadataSize)
+		}
+		return nil
+	})
+	return metadata, err
+}
+
 // func getElectedValidators(client *http.Client) ([]electedValidator, error) {
 // 	electedValidators := new(electedValidators)
 
@@ -0,0 +1,144 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/go-pg/pg/v10"
+)
+
+//pastEpoch is the data fetched for a past epoch by a backfill worker.
+type pastEpoch struct {
+	epoch   uint64
+	elected ElectedValidatorsAtEpoch
+	err     error
+}
+
+//backfillEpochs indexes the epochs from `from` to `to` (inclusive), adding each one to `report` once it's committed.
+//See fetchEpochsInOrder for how they're fetched and committed.
+//
+//`EpochsServed` is recomputed from all the Elections once, after the last epoch is committed or the backfill stopped,
+//rather than with each epoch.
+func backfillEpochs(ctx context.Context, DB *pg.DB, src ChainSource, from, to uint64, cfg *Config, report *Report) error {
+	network, ok := cfg.NetworkProfile()
+	if !ok {
+		return fmt.Errorf("backfill: unknown network %q", cfg.Network)
+	}
+	calendar := network.Calendar()
+
+	committed := 0
+	err := fetchEpochsInOrder(ctx, src, from, to, cfg, func(epoch uint64, elected ElectedValidatorsAtEpoch) error {
+		Log(ctx).Info("Indexing past epoch", LogEpoch, epoch)
+		if err := storePastEpoch(ctx, DB, calendar, epoch, elected); err != nil {
+			return err
+		}
+		committed++
+		report.EpochsIndexed = append(report.EpochsIndexed, epoch)
+		metrics.observeIndexedEpoch(epoch)
+		return nil
+	})
+
+	if committed > 0 {
+		if _, recomputeErr := recomputeEpochsServed(DB.WithContext(ctx)); recomputeErr != nil && err == nil {
+			err = persistError("recompute epochs served", recomputeErr)
+		}
+	}
+	return err
+}
+
+//fetchEpochsInOrder fetches the elected Validators of the epochs from `from` to `to` (inclusive), and calls `commit`
+//with each epoch in turn.
+//
+//The elected Validators of up to `cfg.BackfillWorkers` epochs are fetched at once, rate limited by a token bucket
+//shared by all the workers. Epochs are committed strictly in order, so that `findLastIndexedEpoch` stays a valid
+//resume point: if an epoch fails to be fetched or committed, none of the epochs after it are committed.
+func fetchEpochsInOrder(ctx context.Context, src ChainSource, from, to uint64, cfg *Config, commit func(epoch uint64, elected ElectedValidatorsAtEpoch) error) error {
+	if from > to {
+		return nil
+	}
+
+	workers := cfg.BackfillWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	limiter := newTokenBucket(cfg.BackfillRate, cfg.BackfillBurst)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// `window` bounds how far the workers can get ahead of the epoch being committed.
+	window := make(chan struct{}, 2*workers)
+	epochs := make(chan uint64)
+	results := make(chan pastEpoch)
+
+	go func() {
+		defer close(epochs)
+		for epoch := from; epoch <= to; epoch++ {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case epochs <- epoch:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for epoch := range epochs {
+				result := pastEpoch{epoch: epoch}
+				if result.err = limiter.Wait(ctx); result.err == nil {
+					result.elected, result.err = src.ElectedValidatorsAtEpoch(ctx, epoch)
+				}
+				select {
+				case results <- result:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Commit the fetched epochs in order, holding on to the ones that arrive early.
+	fetched := make(map[uint64]pastEpoch)
+	next := from
+	for result := range results {
+		fetched[result.epoch] = result
+
+		for {
+			result, ok := fetched[next]
+			if !ok {
+				break
+			}
+			delete(fetched, next)
+
+			if result.err != nil {
+				return fetchError(fmt.Sprintf("elected validators at epoch %d", next), result.err)
+			}
+			if err := commit(next, result.elected); err != nil {
+				return err
+			}
+
+			<-window
+			if next == to {
+				return nil
+			}
+			next++
+		}
+	}
+
+	// The results were closed before every epoch was committed, which only happens once ctx is done.
+	return ctx.Err()
+}
@@ -0,0 +1,175 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+//backfillSource is a ChainSource whose later epochs are fetched faster, so that they arrive out of order,
+//and that fails to fetch the epoch `fail`.
+type backfillSource struct {
+	FixtureSource
+	to   uint64
+	fail uint64
+
+	mu      sync.Mutex
+	fetched []uint64
+}
+
+var errEpochUnavailable = errors.New("epoch unavailable")
+
+func (s *backfillSource) ElectedValidatorsAtEpoch(ctx context.Context, epoch uint64) (ElectedValidatorsAtEpoch, error) {
+	select {
+	case <-time.After(time.Duration(s.to-epoch) * 5 * time.Millisecond):
+	case <-ctx.Done():
+		return ElectedValidatorsAtEpoch{}, ctx.Err()
+	}
+	s.mu.Lock()
+	s.fetched = append(s.fetched, epoch)
+	s.mu.Unlock()
+
+	if epoch == s.fail {
+		return ElectedValidatorsAtEpoch{}, errEpochUnavailable
+	}
+	return electedAt(epoch), nil
+}
+
+//electedAt returns the elected Validators of `epoch`: a single one, whose address is the epoch.
+func electedAt(epoch uint64) ElectedValidatorsAtEpoch {
+	var elected ElectedValidatorsAtEpoch
+	json.Unmarshal([]byte(fmt.Sprintf(`{"celoElectedValidators": [{"celoAccount": {"address": "0x%d"}}]}`, epoch)), &elected)
+	return elected
+}
+
+func backfillConfig(workers int) *Config {
+	cfg := DefaultConfig()
+	cfg.BackfillWorkers = workers
+	cfg.BackfillRate = 0
+	return cfg
+}
+
+func TestFetchEpochsInOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		from, to  uint64
+		fail      uint64
+		workers   int
+		committed []uint64
+	}{
+		{"all", 1, 8, 0, 4, []uint64{1, 2, 3, 4, 5, 6, 7, 8}},
+		{"one worker", 3, 6, 0, 1, []uint64{3, 4, 5, 6}},
+		{"failed epoch", 1, 8, 5, 4, []uint64{1, 2, 3, 4}},
+		{"first epoch fails", 1, 8, 1, 4, nil},
+		{"last epoch fails", 1, 8, 8, 4, []uint64{1, 2, 3, 4, 5, 6, 7}},
+		{"empty range", 5, 4, 0, 4, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := &backfillSource{to: tt.to, fail: tt.fail}
+			var committed []uint64
+			err := fetchEpochsInOrder(context.Background(), src, tt.from, tt.to, backfillConfig(tt.workers), func(epoch uint64, elected ElectedValidatorsAtEpoch) error {
+				if !reflect.DeepEqual(elected, electedAt(epoch)) {
+					t.Errorf("epoch %d committed with the elected validators %+v", epoch, elected)
+				}
+				committed = append(committed, epoch)
+				return nil
+			})
+
+			if tt.fail != 0 {
+				if !errors.Is(err, ErrFetch) || !errors.Is(err, errEpochUnavailable) {
+					t.Errorf("fetchEpochsInOrder() error = %v, want a fetch error of epoch %d", err, tt.fail)
+				}
+			} else if err != nil {
+				t.Errorf("fetchEpochsInOrder() error = %v", err)
+			}
+			if !reflect.DeepEqual(committed, tt.committed) {
+				t.Errorf("committed %v, want %v", committed, tt.committed)
+			}
+		})
+	}
+}
+
+func TestFetchEpochsInOrderFetchesOutOfOrder(t *testing.T) {
+	src := &backfillSource{to: 8}
+	err := fetchEpochsInOrder(context.Background(), src, 1, 8, backfillConfig(4), func(uint64, ElectedValidatorsAtEpoch) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sorted := func() bool {
+		for i := 1; i < len(src.fetched); i++ {
+			if src.fetched[i] < src.fetched[i-1] {
+				return false
+			}
+		}
+		return true
+	}(); sorted {
+		t.Errorf("epochs fetched in order %v, the test doesn't exercise reordering", src.fetched)
+	}
+}
+
+func TestFetchEpochsInOrderCommitFails(t *testing.T) {
+	errCommit := errors.New("commit failed")
+	var committed []uint64
+	err := fetchEpochsInOrder(context.Background(), &backfillSource{to: 8}, 1, 8, backfillConfig(4), func(epoch uint64, _ ElectedValidatorsAtEpoch) error {
+		if epoch == 3 {
+			return errCommit
+		}
+		committed = append(committed, epoch)
+		return nil
+	})
+	if !errors.Is(err, errCommit) {
+		t.Errorf("fetchEpochsInOrder() error = %v, want %v", err, errCommit)
+	}
+	if want := []uint64{1, 2}; !reflect.DeepEqual(committed, want) {
+		t.Errorf("committed %v, want %v", committed, want)
+	}
+}
+
+func TestFetchEpochsInOrderCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	err := fetchEpochsInOrder(ctx, &backfillSource{to: 8}, 1, 8, backfillConfig(4), func(epoch uint64, _ ElectedValidatorsAtEpoch) error {
+		if epoch == 2 {
+			cancel()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("fetchEpochsInOrder() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestBackfillFromFixtures(t *testing.T) {
+	src := loadTestFixtures(t)
+	var committed []uint64
+	elected := make(map[uint64]int)
+	err := fetchEpochsInOrder(context.Background(), src, 7, 9, backfillConfig(2), func(epoch uint64, e ElectedValidatorsAtEpoch) error {
+		committed = append(committed, epoch)
+		elected[epoch] = len(e.CeloElectedValidators)
+		return nil
+	})
+	// Epoch 7 isn't in the fixtures, so nothing after it is committed either.
+	if err == nil || committed != nil {
+		t.Errorf("backfill from 7 committed %v, %v, want an error and nothing committed", committed, err)
+	}
+
+	committed = nil
+	if err := fetchEpochsInOrder(context.Background(), src, 8, 9, backfillConfig(2), func(epoch uint64, e ElectedValidatorsAtEpoch) error {
+		committed = append(committed, epoch)
+		elected[epoch] = len(e.CeloElectedValidators)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint64{8, 9}; !reflect.DeepEqual(committed, want) {
+		t.Errorf("committed %v, want %v", committed, want)
+	}
+	if elected[8] != 1 || elected[9] != 2 {
+		t.Errorf("elected validators by epoch = %v, want 1 in epoch 8 and 2 in epoch 9", elected)
+	}
+}
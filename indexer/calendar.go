@@ -0,0 +1,40 @@
+package indexer
+
+//EpochCalendar maps between epochs and blocks. Epochs are numbered from 1, and epoch N spans
+//blocks (N-1)*BlocksPerEpoch+1 to N*BlocksPerEpoch inclusive. Block 0, the genesis block, is in no epoch.
+type EpochCalendar struct {
+	BlocksPerEpoch uint64
+}
+
+//sampleOffset is how far into an epoch SampleBlock is, so that the election at the start of the epoch has settled.
+const sampleOffset = 500
+
+//EpochOfBlock returns the epoch `block` is in, 0 for the genesis block.
+func (c EpochCalendar) EpochOfBlock(block uint64) uint64 {
+	if block == 0 {
+		return 0
+	}
+	return (block-1)/c.BlocksPerEpoch + 1
+}
+
+//FirstBlock returns the first block of `epoch`.
+func (c EpochCalendar) FirstBlock(epoch uint64) uint64 {
+	if epoch == 0 {
+		return 0
+	}
+	return (epoch-1)*c.BlocksPerEpoch + 1
+}
+
+//LastBlock returns the last block of `epoch`, where its election happens.
+func (c EpochCalendar) LastBlock(epoch uint64) uint64 {
+	return epoch * c.BlocksPerEpoch
+}
+
+//SampleBlock returns the block at which the Validators elected for `epoch` are looked up.
+//It's a few hundred blocks into the epoch, except for epoch 1 where it's halfway through.
+func (c EpochCalendar) SampleBlock(epoch uint64) uint64 {
+	if epoch <= 1 {
+		return c.BlocksPerEpoch / 2
+	}
+	return c.FirstBlock(epoch) - 1 + sampleOffset
+}
@@ -0,0 +1,103 @@
+package indexer
+
+import (
+	"testing"
+	"time"
+)
+
+var mainnetCalendar = EpochCalendar{BlocksPerEpoch: 17280}
+
+func TestEpochOfBlock(t *testing.T) {
+	tests := []struct {
+		block uint64
+		epoch uint64
+	}{
+		{0, 0},
+		{1, 1},
+		{2, 1},
+		{17279, 1},
+		{17280, 1},
+		{17281, 2},
+		{34560, 2},
+		{34561, 3},
+		{17280000000, 1000000},
+		{17280000001, 1000001},
+	}
+	for _, tt := range tests {
+		if got := mainnetCalendar.EpochOfBlock(tt.block); got != tt.epoch {
+			t.Errorf("EpochOfBlock(%d) = %d, want %d", tt.block, got, tt.epoch)
+		}
+	}
+}
+
+func TestEpochBlocks(t *testing.T) {
+	tests := []struct {
+		epoch  uint64
+		first  uint64
+		last   uint64
+		sample uint64
+	}{
+		{0, 0, 0, 8640},
+		{1, 1, 17280, 8640},
+		{2, 17281, 34560, 17780},
+		{3, 34561, 51840, 35060},
+		{1000000, 17279982721, 17280000000, 17279983220},
+	}
+	for _, tt := range tests {
+		if got := mainnetCalendar.FirstBlock(tt.epoch); got != tt.first {
+			t.Errorf("FirstBlock(%d) = %d, want %d", tt.epoch, got, tt.first)
+		}
+		if got := mainnetCalendar.LastBlock(tt.epoch); got != tt.last {
+			t.Errorf("LastBlock(%d) = %d, want %d", tt.epoch, got, tt.last)
+		}
+		if got := mainnetCalendar.SampleBlock(tt.epoch); got != tt.sample {
+			t.Errorf("SampleBlock(%d) = %d, want %d", tt.epoch, got, tt.sample)
+		}
+	}
+}
+
+func TestEpochBlocksRoundTrip(t *testing.T) {
+	for _, epoch := range []uint64{1, 2, 3, 100, 1000000} {
+		for _, block := range []uint64{
+			mainnetCalendar.FirstBlock(epoch),
+			mainnetCalendar.LastBlock(epoch),
+			mainnetCalendar.SampleBlock(epoch),
+		} {
+			if got := mainnetCalendar.EpochOfBlock(block); got != epoch {
+				t.Errorf("EpochOfBlock(%d) = %d, want %d", block, got, epoch)
+			}
+		}
+		if got := mainnetCalendar.EpochOfBlock(mainnetCalendar.FirstBlock(epoch) - 1); got != epoch-1 {
+			t.Errorf("block before epoch %d is in epoch %d, want %d", epoch, got, epoch-1)
+		}
+	}
+}
+
+func TestNetworkCalendars(t *testing.T) {
+	if got := Networks["mainnet"].Calendar(); got != mainnetCalendar {
+		t.Errorf("mainnet calendar = %+v, want %+v", got, mainnetCalendar)
+	}
+}
+
+func TestEpochAt(t *testing.T) {
+	mainnet := Networks["mainnet"]
+	genesis := mainnet.GenesisTime
+	epoch := mainnet.EpochDuration()
+	tests := []struct {
+		name  string
+		t     time.Time
+		epoch uint64
+	}{
+		{"before genesis", genesis.Add(-time.Hour), 0},
+		{"at genesis", genesis, 0},
+		{"first block", genesis.Add(mainnet.BlockTime), 1},
+		{"last block of epoch 1", genesis.Add(epoch), 1},
+		{"first block of epoch 2", genesis.Add(epoch + mainnet.BlockTime), 2},
+		{"epoch 1000", genesis.Add(999*epoch + time.Hour), 1000},
+	}
+	for _, tt := range tests {
+		if got := mainnet.EpochAt(tt.t); got != tt.epoch {
+			t.Errorf("%s: EpochAt() = %d, want %d", tt.name, got, tt.epoch)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package indexer
+
+import (
+	"flag"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+//setEnv sets the environment variables `env` for the duration of the test.
+func setEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+	for k, v := range env {
+		old, ok := os.LookupEnv(k)
+		os.Setenv(k, v)
+		k := k
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(k, old)
+			} else {
+				os.Unsetenv(k)
+			}
+		})
+	}
+}
+
+func TestValidateDataServiceURL(t *testing.T) {
+	tests := []struct {
+		name  string
+		env   map[string]string
+		args  []string
+		valid bool
+	}{
+		{"mainnet host", map[string]string{"NETWORK": "mainnet", "DATA_SERVICE_HOST": "celo-data"}, nil, true},
+		{"testnet host", map[string]string{"NETWORK": "alfajores", "DATA_SERVICE_HOST": "celo-data"}, nil, false},
+		{"testnet url", map[string]string{"NETWORK": "alfajores", "DATA_SERVICE_URL": "http://localhost:3000"}, nil, true},
+		{"testnet host and url", map[string]string{"NETWORK": "baklava", "DATA_SERVICE_HOST": "celo-data", "DATA_SERVICE_URL": "http://localhost:3000"}, nil, true},
+		{"testnet host and flag", map[string]string{"NETWORK": "baklava", "DATA_SERVICE_HOST": "celo-data"}, []string{"-data-service-url", "http://localhost:3000"}, true},
+		{"testnet flag", nil, []string{"-network", "alfajores", "-data-service-url", "http://localhost:3000"}, true},
+		{"testnet without url", map[string]string{"NETWORK": "alfajores"}, nil, false},
+		{"testnet fixtures", map[string]string{"NETWORK": "alfajores", "DATA_SERVICE_HOST": "celo-data", "FIXTURES": "fixtures.json"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"DB_URL": "postgres://localhost:5432/celo", "NETWORK": "", "DATA_SERVICE_HOST": "", "DATA_SERVICE_URL": "", "FIXTURES": ""}
+			for k, v := range tt.env {
+				env[k] = v
+			}
+			setEnv(t, env)
+
+			cfg, err := LoadConfig(flag.NewFlagSet("test", flag.ContinueOnError), tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = cfg.Validate()
+			if tt.valid && err != nil {
+				t.Errorf("Validate() error = %v", err)
+			}
+			if !tt.valid && (err == nil || !strings.Contains(err.Error(), "data-service")) {
+				t.Errorf("Validate() error = %v, want a data-service problem", err)
+			}
+		})
+	}
+}
+
+//validConfig returns a Config that passes Validate.
+func validConfig() *Config {
+	cfg := DefaultConfig()
+	cfg.DatabaseURL = "postgres://localhost:5432/celo"
+	cfg.DataServiceURL = "http://localhost:3000"
+	cfg.ExplorerURL = "https://explorer.celo.org/graphiql"
+	return cfg
+}
+
+func TestValidateRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint RetryPolicy
+		problem  string
+	}{
+		{"default policy", DefaultRetryConfig().Default, ""},
+		{"single attempt", RetryPolicy{MaxAttempts: 1, BaseDelay: time.Second, MaxDelay: time.Second}, ""},
+		{"no attempts", RetryPolicy{MaxAttempts: 0, BaseDelay: time.Second, MaxDelay: time.Second}, "at least 1 attempt"},
+		{"negative attempts", RetryPolicy{MaxAttempts: -1, BaseDelay: time.Second, MaxDelay: time.Second}, "at least 1 attempt"},
+		{"zero base delay", RetryPolicy{MaxAttempts: 3, BaseDelay: 0, MaxDelay: time.Second}, "positive base delay"},
+		{"negative base delay", RetryPolicy{MaxAttempts: 3, BaseDelay: -time.Second, MaxDelay: time.Second}, "positive base delay"},
+		{"max under base", RetryPolicy{MaxAttempts: 3, BaseDelay: 2 * time.Second, MaxDelay: time.Second}, "shorter than its base delay"},
+		{"negative breaker threshold", RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Second, BreakerThreshold: -1}, "negative breaker threshold"},
+		{"breaker without cooldown", RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Second, BreakerThreshold: 5}, "positive breaker cooldown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.Retry.Endpoints = map[string]RetryPolicy{"explorer": tt.endpoint}
+
+			err := cfg.Validate()
+			if tt.problem == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), `endpoint "explorer" retry policy`) || !strings.Contains(err.Error(), tt.problem) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.problem)
+			}
+		})
+	}
+
+	cfg := validConfig()
+	cfg.Retry.Default.MaxAttempts = 0
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "default retry policy") {
+		t.Errorf("Validate() error = %v, want a problem with the default retry policy", err)
+	}
+}
@@ -0,0 +1,103 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+)
+
+//ErrMalformedResponse is returned when a response of the data-service can't be decoded, or holds invalid data.
+var ErrMalformedResponse = errors.New("malformed response")
+
+//dataServiceClient is a client of the data-service HTTP API.
+//Every response is checked for a 2xx status and a well-formed JSON body before it's used.
+type dataServiceClient struct {
+	httpClient *http.Client
+	baseURL    string
+}
+
+//get GETs `path` and decodes the JSON body into `v`.
+//It returns a *StatusError for a non-2xx response, and wraps ErrMalformedResponse if the body can't be decoded.
+func (c *dataServiceClient) get(ctx context.Context, path string, v interface{}) error {
+	url := c.baseURL + path
+	resp, err := httpGet(ctx, c.httpClient, url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// Drain the body so the connection can be reused.
+		io.Copy(ioutil.Discard, resp.Body)
+		return &StatusError{Code: resp.StatusCode, URL: url}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("%s: %w: %v", url, ErrMalformedResponse, err)
+	}
+	return nil
+}
+
+//currentEpoch fetches the epoch the chain is currently in. Epoch 0 is never valid.
+func (c *dataServiceClient) currentEpoch(ctx context.Context) (uint64, error) {
+	epoch := new(currentEpoch)
+	if err := c.get(ctx, "/current-epoch", epoch); err != nil {
+		return 0, err
+	}
+	if epoch.Epoch == 0 {
+		return 0, fmt.Errorf("current-epoch: %w: epoch 0", ErrMalformedResponse)
+	}
+	return epoch.Epoch, nil
+}
+
+//downtimeScore fetches the slashing multiplier of the ValidatorGroup at `address`, which has to be a number.
+func (c *dataServiceClient) downtimeScore(ctx context.Context, address string) (string, error) {
+	multiplier := new(slashingMultiplier)
+	if err := c.get(ctx, "/downtime-score/"+address, multiplier); err != nil {
+		return "", err
+	}
+	if err := validateNumber(multiplier.Multiplier); err != nil {
+		return "", fmt.Errorf("downtime-score/%s: %w: multiplier %v", address, ErrMalformedResponse, err)
+	}
+	return multiplier.Multiplier, nil
+}
+
+//targetAPY fetches the target yield set by the network, which has to be a number.
+func (c *dataServiceClient) targetAPY(ctx context.Context) (string, error) {
+	apy := new(targetApy)
+	if err := c.get(ctx, "/target-apy", apy); err != nil {
+		return "", err
+	}
+	if err := validateNumber(apy.TargetApy); err != nil {
+		return "", fmt.Errorf("target-apy: %w: target apy %v", ErrMalformedResponse, err)
+	}
+	return apy.TargetApy, nil
+}
+
+//epochRegistered fetches the epoch the ValidatorGroup at `address` registered at. A missing epoch decodes as
+//epoch 0, which is never valid.
+func (c *dataServiceClient) epochRegistered(ctx context.Context, address string) (EpochVGRegistered, error) {
+	epochRegistered := new(EpochVGRegistered)
+	if err := c.get(ctx, "/epoch-vg-registered/"+address, epochRegistered); err != nil {
+		return EpochVGRegistered{}, err
+	}
+	if epochRegistered.Epoch <= 0 {
+		return EpochVGRegistered{}, fmt.Errorf("epoch-vg-registered/%s: %w: epoch %d", address, ErrMalformedResponse, epochRegistered.Epoch)
+	}
+	return *epochRegistered, nil
+}
+
+func validateNumber(number string) error {
+	if number == "" {
+		return errors.New("is empty")
+	}
+	if _, _, err := big.ParseFloat(number, 10, 64, big.ToZero); err != nil {
+		return fmt.Errorf("%q isn't a number", number)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEpochRegistered(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		epoch int
+		err   error
+	}{
+		{"registered", `{"block": 345600, "epoch": 20}`, 20, nil},
+		{"missing epoch", `{"block": 345600}`, 0, ErrMalformedResponse},
+		{"zero epoch", `{"block": 0, "epoch": 0}`, 0, ErrMalformedResponse},
+		{"negative epoch", `{"block": 0, "epoch": -1}`, 0, ErrMalformedResponse},
+		{"not JSON", `Not Found`, 0, ErrMalformedResponse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/epoch-vg-registered/0xgroup" {
+					http.NotFound(w, r)
+					return
+				}
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			c := &dataServiceClient{httpClient: server.Client(), baseURL: server.URL}
+			got, err := c.epochRegistered(context.Background(), "0xgroup")
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("epochRegistered() error = %v, want %v", err, tt.err)
+			}
+			if got.Epoch != tt.epoch {
+				t.Errorf("epochRegistered() epoch = %d, want %d", got.Epoch, tt.epoch)
+			}
+		})
+	}
+}
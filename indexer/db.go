@@ -3,18 +3,273 @@ package indexer
 import (
 	"github.com/buidl-labs/celo-voting-validator-backend/graph/model"
 	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
 )
 
 //NoResultError is thrown by go-pg when it can't find any result for the query
 const NoResultError = "pg: no rows in result set"
 
+//findLastIndexedEpoch returns the Epoch with the highest number, which runs resume after.
+//Epochs are committed in order, and `Reindex` never goes past it, so every Epoch before it is in the DB.
 func findLastIndexedEpoch(DB *pg.DB) (*model.Epoch, error) {
 
 	epoch := new(model.Epoch)
-	err := DB.Model(epoch).Order("created_at desc").Limit(1).Select()
+	err := DB.Model(epoch).Order("number DESC").Limit(1).Select()
 	if err != nil {
 		return epoch, err
 	}
 
 	return epoch, nil
 }
+
+//upsertValidatorStats writes the stats of a Validator for an epoch, replacing the stats already stored for that (epoch, validator).
+//Stats that are replaced keep their ID and CreatedAt, which are set on `stats` either way.
+func upsertValidatorStats(DB orm.DB, stats *model.ValidatorStats) error {
+	_, err := DB.Model(stats).
+		OnConflict("(epoch_id, validator_id) DO UPDATE").
+		Set("attestations_requested = EXCLUDED.attestations_requested").
+		Set("attestations_fulfilled = EXCLUDED.attestations_fulfilled").
+		Set("last_elected = EXCLUDED.last_elected").
+		Set("score = EXCLUDED.score").
+		Returning("id, created_at").
+		Insert()
+	return err
+}
+
+//upsertValidatorGroupStats writes the stats of a ValidatorGroup for an epoch, replacing the stats already stored for that (epoch, group).
+//Stats that are replaced keep their ID and CreatedAt, which are set on `stats` either way.
+func upsertValidatorGroupStats(DB orm.DB, stats *model.ValidatorGroupStats) error {
+	_, err := DB.Model(stats).
+		OnConflict("(epoch_id, validator_group_id) DO UPDATE").
+		Set("locked_celo = EXCLUDED.locked_celo").
+		Set("group_share = EXCLUDED.group_share").
+		Set("votes = EXCLUDED.votes").
+		Set("voting_cap = EXCLUDED.voting_cap").
+		Set("attestation_percentage = EXCLUDED.attestation_percentage").
+		Set("slashing_score = EXCLUDED.slashing_score").
+		Set("group_score = EXCLUDED.group_score").
+		Set("estimated_apy = EXCLUDED.estimated_apy").
+		Returning("id, created_at").
+		Insert()
+	return err
+}
+
+//electionsAt returns the Elections of the Validators in `elected`, skipping the ones without a ValidatorGroup.
+func electionsAt(epoch uint64, elected ElectedValidatorsAtEpoch) []*Election {
+	elections := make([]*Election, 0, len(elected.CeloElectedValidators))
+	for _, v := range elected.CeloElectedValidators {
+		if v.CeloAccount.Validator.GroupInfo.Address == "" {
+			continue
+		}
+		elections = append(elections, &Election{
+			EpochNumber:      epoch,
+			ValidatorAddress: v.CeloAccount.Address,
+			GroupAddress:     v.CeloAccount.Validator.GroupInfo.Address,
+		})
+	}
+	return elections
+}
+
+//replaceElections replaces the Elections stored for `epoch` with `elections`.
+func replaceElections(DB orm.DB, epoch uint64, elections []*Election) error {
+	if _, err := DB.Model((*Election)(nil)).Where("epoch_number = ?", epoch).Delete(); err != nil {
+		return err
+	}
+	if len(elections) == 0 {
+		return nil
+	}
+
+	_, err := DB.Model(&elections).Insert()
+	return err
+}
+
+//firstEpochWithoutElections returns the lowest numbered Epoch before `before` that has no Elections,
+//which is only the case of the Epochs indexed before Elections were recorded: `storePastEpoch` refuses to store
+//an Epoch without them.
+func firstEpochWithoutElections(DB *pg.DB, before uint64) (*model.Epoch, error) {
+	epoch := new(model.Epoch)
+	err := DB.Model(epoch).
+		Where("number < ?", before).
+		Where("NOT EXISTS (SELECT 1 FROM elections WHERE elections.epoch_number = epoch.number)").
+		Order("number ASC").
+		Limit(1).
+		Select()
+	return epoch, err
+}
+
+//recomputeEpochsServed sets `EpochsServed` of every ValidatorGroup to the number of epochs it had a Validator elected in,
+//and returns the new counts by ValidatorGroup address.
+func recomputeEpochsServed(DB orm.DB) (map[string]uint64, error) {
+	var counts []struct {
+		Address      string
+		EpochsServed uint64
+	}
+	_, err := DB.Query(&counts, `
+		UPDATE validator_groups AS vg
+		SET epochs_served = (
+			SELECT count(DISTINCT e.epoch_number) FROM elections AS e WHERE e.group_address = vg.address
+		)
+		RETURNING vg.address, vg.epochs_served
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	epochsServed := make(map[string]uint64, len(counts))
+	for _, c := range counts {
+		epochsServed[c.Address] = c.EpochsServed
+	}
+	return epochsServed, nil
+}
+
+//upsertEpoch inserts `epoch`, or updates the Epoch with the same number if there's one.
+//An existing Epoch keeps its ID and CreatedAt, so the stats pointing at it are unaffected; they're set on `epoch` either way.
+func upsertEpoch(DB orm.DB, epoch *model.Epoch) error {
+	_, err := DB.Model(epoch).
+		OnConflict("(number) DO UPDATE").
+		Set("start_block = EXCLUDED.start_block").
+		Set("end_block = EXCLUDED.end_block").
+		Returning("id, created_at").
+		Insert()
+	return err
+}
+
+//knownAddresses returns the addresses of all the rows of `model`'s table, e.g. (*model.ValidatorGroup)(nil), in one query.
+func knownAddresses(DB orm.DB, model interface{}) (map[string]bool, error) {
+	var addresses []string
+	if err := DB.Model(model).Column("address").Select(&addresses); err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool, len(addresses))
+	for _, address := range addresses {
+		known[address] = true
+	}
+	return known, nil
+}
+
+//insertBatch inserts the `n` rows of the slice `rows` points to in one statement, filling in their generated IDs.
+//If the statement fails, the rows are inserted one by one with `row(i)` so that a bad row doesn't keep out the others,
+//and the errors of the rows that still fail are returned by index.
+func insertBatch(DB orm.DB, rows interface{}, n int, row func(i int) interface{}) map[int]error {
+	if n == 0 {
+		return nil
+	}
+	_, err := DB.Model(rows).Insert()
+	if err == nil {
+		return nil
+	}
+	Log(DB.Context()).Warn("Batch insert failed, inserting the rows one by one", "rows", n, "error", err)
+
+	errs := make(map[int]error)
+	for i := 0; i < n; i++ {
+		if _, err := DB.Model(row(i)).Insert(); err != nil {
+			errs[i] = err
+		}
+	}
+	return errs
+}
+
+//syncMemberships reconciles the current Memberships with the affiliates of `groups`, all the ValidatorGroups registered
+//at `epoch`: affiliates without a current Membership join at `epoch`, and current members that aren't affiliated anymore,
+//including all the members of the ValidatorGroups that aren't in `groups` since they de-registered, leave at `epoch`.
+//Validators that left and aren't affiliated with any of `groups` are no longer currently elected.
+//It returns the addresses of the Validators that left.
+func syncMemberships(DB orm.DB, epoch uint64, groups []CeloValidatorGroupAndValidatorBasicData) ([]string, error) {
+	// No group at all is more likely a bad response than every group de-registering.
+	if len(groups) == 0 {
+		return nil, nil
+	}
+
+	affiliated := make(map[string]bool)           // By group and validator address.
+	affiliatedValidators := make(map[string]bool) // By validator address.
+	for _, vg := range groups {
+		for _, v := range vg.Affiliates.Edges {
+			affiliated[vg.Account.Address+"/"+v.Node.Address] = true
+			affiliatedValidators[v.Node.Address] = true
+		}
+	}
+
+	var current []*Membership
+	if err := DB.Model(&current).Where("left_epoch IS NULL").Select(); err != nil {
+		return nil, err
+	}
+
+	isMember := make(map[string]bool, len(current))
+	var leftIDs []string
+	var left []string
+	for _, m := range current {
+		key := m.GroupAddress + "/" + m.ValidatorAddress
+		if affiliated[key] {
+			isMember[key] = true
+			continue
+		}
+		leftIDs = append(leftIDs, m.ID)
+		left = append(left, m.ValidatorAddress)
+	}
+
+	var joined []*Membership
+	for _, vg := range groups {
+		for _, v := range vg.Affiliates.Edges {
+			key := vg.Account.Address + "/" + v.Node.Address
+			if isMember[key] {
+				continue
+			}
+			isMember[key] = true
+			joined = append(joined, &Membership{
+				ValidatorAddress: v.Node.Address,
+				GroupAddress:     vg.Account.Address,
+				JoinedEpoch:      epoch,
+			})
+		}
+	}
+
+	if len(leftIDs) > 0 {
+		_, err := DB.Model((*Membership)(nil)).
+			Set("left_epoch = ?", epoch).
+			WhereIn("id IN (?)", leftIDs).
+			Update()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(joined) > 0 {
+		if _, err := DB.Model(&joined).Insert(); err != nil {
+			return nil, err
+		}
+	}
+
+	// A Validator that moved to another group is still active, only the ones that vanished are marked inactive.
+	var inactive []string
+	for _, address := range left {
+		if !affiliatedValidators[address] {
+			inactive = append(inactive, address)
+		}
+	}
+	if len(inactive) > 0 {
+		_, err := DB.Model((*model.Validator)(nil)).
+			Set("currently_elected = ?", false).
+			WhereIn("address IN (?)", inactive).
+			Update()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return left, nil
+}
+
+//currentMembers returns the addresses of the current members of every ValidatorGroup, by ValidatorGroup address.
+func currentMembers(DB orm.DB) (map[string]map[string]bool, error) {
+	var current []*Membership
+	if err := DB.Model(&current).Where("left_epoch IS NULL").Select(); err != nil {
+		return nil, err
+	}
+	members := make(map[string]map[string]bool)
+	for _, m := range current {
+		if members[m.GroupAddress] == nil {
+			members[m.GroupAddress] = make(map[string]bool)
+		}
+		members[m.GroupAddress][m.ValidatorAddress] = true
+	}
+	return members, nil
+}
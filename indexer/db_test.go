@@ -0,0 +1,240 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/buidl-labs/celo-voting-validator-backend/graph/model"
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+//testDB connects to the DB at TEST_DB_URL, in a schema of its own holding the tables of `models`, which is dropped
+//once the test is done. Tests using it are skipped when TEST_DB_URL isn't set.
+func testDB(t *testing.T, models ...interface{}) *pg.DB {
+	t.Helper()
+	url := os.Getenv("TEST_DB_URL")
+	if url == "" {
+		t.Skip("TEST_DB_URL isn't set")
+	}
+	opts, err := pg.ParseURL(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	admin := pg.Connect(opts)
+	t.Cleanup(func() {
+		admin.Exec("DROP SCHEMA IF EXISTS ? CASCADE", pg.Ident(schema))
+		admin.Close()
+	})
+	if _, err := admin.Exec("CREATE SCHEMA ?", pg.Ident(schema)); err != nil {
+		t.Fatal(err)
+	}
+
+	opts.OnConnect = func(ctx context.Context, conn *pg.Conn) error {
+		_, err := conn.ExecContext(ctx, "SET search_path = ?, public", pg.Ident(schema))
+		return err
+	}
+	DB := pg.Connect(opts)
+	t.Cleanup(func() { DB.Close() })
+
+	for _, model := range models {
+		if err := DB.Model(model).CreateTable(&orm.CreateTableOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return DB
+}
+
+func TestLockRun(t *testing.T) {
+	DB := testDB(t)
+	ctx := context.Background()
+
+	unlock, err := lockRun(ctx, DB)
+	if err != nil {
+		t.Fatalf("lockRun() error = %v", err)
+	}
+	if _, err := lockRun(ctx, DB); err != ErrRunInProgress {
+		t.Errorf("lockRun() while locked error = %v, want %v", err, ErrRunInProgress)
+	}
+
+	// Another network's schema has a lock of its own.
+	other := testDB(t)
+	unlockOther, err := lockRun(ctx, other)
+	if err != nil {
+		t.Errorf("lockRun() of another schema error = %v", err)
+	} else {
+		unlockOther()
+	}
+
+	unlock()
+	unlock, err = lockRun(ctx, DB)
+	if err != nil {
+		t.Fatalf("lockRun() after unlock error = %v", err)
+	}
+	unlock()
+}
+
+func TestInsertBatchFallsBackToRows(t *testing.T) {
+	DB := testDB(t, (*model.Validator)(nil))
+	if _, err := DB.Model(&model.Validator{Address: "0xvalidator2"}).Insert(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second row is already in the DB, which fails the batch but not the rows around it.
+	rows := []*model.Validator{{Address: "0xvalidator1"}, {Address: "0xvalidator2"}, {Address: "0xvalidator3"}}
+	errs := insertBatch(DB, &rows, len(rows), func(i int) interface{} { return rows[i] })
+	if len(errs) != 1 || errs[1] == nil {
+		t.Errorf("insertBatch() errors = %v, want one for row 1", errs)
+	}
+	for _, i := range []int{0, 2} {
+		if rows[i].ID == "" {
+			t.Errorf("row %d has no ID", i)
+		}
+	}
+
+	count, err := DB.Model((*model.Validator)(nil)).Count()
+	if err != nil || count != 3 {
+		t.Errorf("%d validators, %v, want 3", count, err)
+	}
+}
+
+func TestInsertBatch(t *testing.T) {
+	DB := testDB(t, (*model.Validator)(nil))
+	rows := []*model.Validator{{Address: "0xvalidator1"}, {Address: "0xvalidator2"}}
+	if errs := insertBatch(DB, &rows, len(rows), func(i int) interface{} { return rows[i] }); errs != nil {
+		t.Errorf("insertBatch() errors = %v", errs)
+	}
+	for i, row := range rows {
+		if row.ID == "" {
+			t.Errorf("row %d has no ID", i)
+		}
+	}
+	if errs := insertBatch(DB, &[]*model.Validator{}, 0, nil); errs != nil {
+		t.Errorf("insertBatch() of no rows errors = %v", errs)
+	}
+}
+
+//groupsOf returns the ValidatorGroups `affiliates` lists the Validators of, by ValidatorGroup address, ordered by address.
+func groupsOf(t *testing.T, affiliates map[string][]string) []CeloValidatorGroupAndValidatorBasicData {
+	t.Helper()
+	addresses := make([]string, 0, len(affiliates))
+	for address := range affiliates {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	groups := make([]CeloValidatorGroupAndValidatorBasicData, len(addresses))
+	for i, address := range addresses {
+		groups[i].Account.Address = address
+		edges := make([]map[string]map[string]string, len(affiliates[address]))
+		for j, validator := range affiliates[address] {
+			edges[j] = map[string]map[string]string{"node": {"address": validator}}
+		}
+		b, err := json.Marshal(map[string]interface{}{"edges": edges})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(b, &groups[i].Affiliates); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return groups
+}
+
+func TestSyncMemberships(t *testing.T) {
+	DB := testDB(t, (*Membership)(nil), (*model.Validator)(nil))
+	// The index of migration 3, so that a Validator can't be a current member of a group twice.
+	if _, err := DB.Exec("CREATE UNIQUE INDEX memberships_current_idx ON memberships (group_address, validator_address) WHERE left_epoch IS NULL"); err != nil {
+		t.Fatal(err)
+	}
+	for _, address := range []string{"0xvalidator1", "0xvalidator2", "0xvalidator3"} {
+		if _, err := DB.Model(&model.Validator{Address: address, CurrentlyElected: true}).Insert(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	steps := []struct {
+		name       string
+		epoch      uint64
+		affiliates map[string][]string
+		left       []string
+		members    map[string]map[string]bool
+	}{
+		{"join", 5, map[string][]string{"0xgroup1": {"0xvalidator1", "0xvalidator2"}, "0xgroup2": {"0xvalidator3"}}, nil,
+			map[string]map[string]bool{"0xgroup1": {"0xvalidator1": true, "0xvalidator2": true}, "0xgroup2": {"0xvalidator3": true}}},
+		{"unchanged", 6, map[string][]string{"0xgroup1": {"0xvalidator1", "0xvalidator2"}, "0xgroup2": {"0xvalidator3"}}, nil,
+			map[string]map[string]bool{"0xgroup1": {"0xvalidator1": true, "0xvalidator2": true}, "0xgroup2": {"0xvalidator3": true}}},
+		{"move", 7, map[string][]string{"0xgroup1": {"0xvalidator1"}, "0xgroup2": {"0xvalidator2", "0xvalidator3"}}, []string{"0xvalidator2"},
+			map[string]map[string]bool{"0xgroup1": {"0xvalidator1": true}, "0xgroup2": {"0xvalidator2": true, "0xvalidator3": true}}},
+		{"leave", 8, map[string][]string{"0xgroup1": {"0xvalidator1"}, "0xgroup2": {"0xvalidator3"}}, []string{"0xvalidator2"},
+			map[string]map[string]bool{"0xgroup1": {"0xvalidator1": true}, "0xgroup2": {"0xvalidator3": true}}},
+		// Group 1 de-registered, its members leave with it.
+		{"rejoin", 9, map[string][]string{"0xgroup2": {"0xvalidator2", "0xvalidator3"}}, []string{"0xvalidator1"},
+			map[string]map[string]bool{"0xgroup2": {"0xvalidator2": true, "0xvalidator3": true}}},
+	}
+	for _, step := range steps {
+		left, err := syncMemberships(DB, step.epoch, groupsOf(t, step.affiliates))
+		if err != nil {
+			t.Fatalf("%s: syncMemberships() error = %v", step.name, err)
+		}
+		if !reflect.DeepEqual(left, step.left) {
+			t.Errorf("%s: left = %v, want %v", step.name, left, step.left)
+		}
+		members, err := currentMembers(DB)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(members, step.members) {
+			t.Errorf("%s: current members = %v, want %v", step.name, members, step.members)
+		}
+	}
+
+	var memberships []Membership
+	if err := DB.Model(&memberships).Where("validator_address = ?", "0xvalidator2").Order("joined_epoch").Select(); err != nil {
+		t.Fatal(err)
+	}
+	type span struct {
+		group       string
+		joined      uint64
+		left        uint64
+		stillMember bool
+	}
+	var got []span
+	for _, m := range memberships {
+		s := span{group: m.GroupAddress, joined: m.JoinedEpoch, stillMember: m.LeftEpoch == nil}
+		if m.LeftEpoch != nil {
+			s.left = *m.LeftEpoch
+		}
+		got = append(got, s)
+	}
+	want := []span{{"0xgroup1", 5, 7, false}, {"0xgroup2", 7, 8, false}, {"0xgroup2", 9, 0, true}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("memberships of validator 2 = %+v, want %+v", got, want)
+	}
+
+	// Validator 2 left at epoch 8 and validator 1 with its group, both without another group to go to. Rejoining doesn't
+	// make validator 2 elected again, the elections of the current epoch do.
+	var inactive []string
+	if err := DB.Model((*model.Validator)(nil)).Column("address").Where("NOT currently_elected").Order("address").Select(&inactive); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"0xvalidator1", "0xvalidator2"}; !reflect.DeepEqual(inactive, want) {
+		t.Errorf("validators no longer currently elected = %v, want %v", inactive, want)
+	}
+}
+
+func TestSyncMembershipsWithoutGroups(t *testing.T) {
+	// An empty response is ignored rather than closing every Membership, before the DB is used.
+	left, err := syncMemberships(nil, 5, nil)
+	if err != nil || left != nil {
+		t.Errorf("syncMemberships() = %v, %v, want nothing", left, err)
+	}
+}
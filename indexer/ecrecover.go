@@ -0,0 +1,47 @@
+package indexer
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"golang.org/x/crypto/sha3"
+)
+
+//ErrInvalidSignature is returned when no public key can be recovered from a signature.
+var ErrInvalidSignature = errors.New("invalid signature")
+
+//keccak256 returns the Keccak-256 hash of the concatenation of `data`, as used by Ethereum and Celo.
+func keccak256(data ...[]byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+//ecrecover returns the address, as 0x-prefixed lowercase hex, of the key that produced the 65 bytes
+//signature `sig` (r ‖ s ‖ v, v being 0, 1, 27 or 28) of the 32 bytes `hash`.
+func ecrecover(hash, sig []byte) (string, error) {
+	if len(hash) != 32 || len(sig) != 65 {
+		return "", ErrInvalidSignature
+	}
+	v := sig[64]
+	if v >= 27 {
+		v -= 27
+	}
+	if v > 1 {
+		return "", ErrInvalidSignature
+	}
+
+	// A compact signature is v ‖ r ‖ s, v being 27 plus the recovery id for an uncompressed key.
+	compact := make([]byte, 65)
+	compact[0] = 27 + v
+	copy(compact[1:], sig[:64])
+	pub, _, err := ecdsa.RecoverCompact(compact, hash)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	return "0x" + hex.EncodeToString(keccak256(pub.SerializeUncompressed()[1:])[12:]), nil
+}
@@ -0,0 +1,141 @@
+package indexer
+
+import (
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+//signForTest signs `hash` with the private key `d`, returning r ‖ s ‖ v with v being 27 or 28.
+//Signatures are deterministic (RFC 6979).
+func signForTest(t *testing.T, d *big.Int, hash []byte) []byte {
+	t.Helper()
+	compact := ecdsa.SignCompact(secp256k1.PrivKeyFromBytes(d.Bytes()), hash, false)
+	return append(compact[1:], compact[0])
+}
+
+func addressOfKey(d *big.Int) string {
+	pub := secp256k1.PrivKeyFromBytes(d.Bytes()).PubKey().SerializeUncompressed()
+	return "0x" + hex.EncodeToString(keccak256(pub[1:])[12:])
+}
+
+func TestKeccak256(t *testing.T) {
+	tests := []struct {
+		data [][]byte
+		hash string
+	}{
+		{nil, "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470"},
+		{[][]byte{{}}, "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470"},
+		{[][]byte{[]byte("hello"), []byte(" world")}, hex.EncodeToString(keccak256([]byte("hello world")))},
+	}
+	for _, tt := range tests {
+		if got := hex.EncodeToString(keccak256(tt.data...)); got != tt.hash {
+			t.Errorf("keccak256(%q) = %s, want %s", tt.data, got, tt.hash)
+		}
+	}
+}
+
+func TestAddressOfKey(t *testing.T) {
+	tests := []struct {
+		key     string
+		address string
+	}{
+		{"01", "0x7e5f4552091a69125d5dfcb7b8c2659029395bdf"},
+		// go-ethereum's crypto test key.
+		{"289c2857d4598e37fb9647507e47a309d6133539bf21a8b9cb6df88fd5232032", "0x970e8128ab834e8eac17ab8e3812f010678cf791"},
+	}
+	for _, tt := range tests {
+		d := new(big.Int).SetBytes(mustDecodeHex(t, tt.key))
+		if got := addressOfKey(d); got != tt.address {
+			t.Errorf("address of key %s = %s, want %s", tt.key, got, tt.address)
+		}
+	}
+}
+
+func TestEcrecover(t *testing.T) {
+	// go-ethereum's crypto.Ecrecover test vector.
+	hash := mustDecodeHex(t, "ce0677bb30baa8cf067c88db9811f4333d131bf8bcf12fe7065d211dce971008")
+	sig := mustDecodeHex(t, "90f27b8b488db00b00606796d2987f6a5f59ae62ea05effe84fef5b8b0e549984a691139ad57a3f0b906637673aa2f63d1f55cb1a69199d4009eea23ceaddc9301")
+	const signer = "0xa19d069d48d2e9392ec2bb41ecab0a72119d633b"
+
+	withV := func(v byte) []byte {
+		s := append([]byte(nil), sig...)
+		s[64] = v
+		return s
+	}
+	with := func(from int, b []byte) []byte {
+		s := append([]byte(nil), sig...)
+		copy(s[from:], b)
+		return s
+	}
+	word := func(n *big.Int) []byte { return n.FillBytes(make([]byte, 32)) }
+
+	tests := []struct {
+		name    string
+		hash    []byte
+		sig     []byte
+		address string
+		err     error
+	}{
+		{"v 1", hash, sig, signer, nil},
+		{"v 28", hash, withV(28), signer, nil},
+		{"other parity", hash, withV(0), "", nil},
+		{"v 2", hash, withV(2), "", ErrInvalidSignature},
+		{"v 26", hash, withV(26), "", ErrInvalidSignature},
+		{"v 29", hash, withV(29), "", ErrInvalidSignature},
+		{"r 0", hash, with(0, word(big.NewInt(0))), "", ErrInvalidSignature},
+		{"r n", hash, with(0, word(secp256k1.S256().N)), "", ErrInvalidSignature},
+		{"r not on the curve", hash, with(0, word(big.NewInt(5))), "", ErrInvalidSignature},
+		{"s 0", hash, with(32, word(big.NewInt(0))), "", ErrInvalidSignature},
+		{"s n", hash, with(32, word(secp256k1.S256().N)), "", ErrInvalidSignature},
+		{"short signature", hash, sig[:64], "", ErrInvalidSignature},
+		{"short hash", hash[:31], sig, "", ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ecrecover(tt.hash, tt.sig)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("ecrecover() error = %v, want %v", err, tt.err)
+			}
+			if tt.err != nil {
+				return
+			}
+			if tt.address == "" {
+				if got == signer {
+					t.Errorf("ecrecover() = %s, want another address", got)
+				}
+			} else if got != tt.address {
+				t.Errorf("ecrecover() = %s, want %s", got, tt.address)
+			}
+		})
+	}
+}
+
+func TestEcrecoverSigned(t *testing.T) {
+	for _, key := range []string{"01", "289c2857d4598e37fb9647507e47a309d6133539bf21a8b9cb6df88fd5232032"} {
+		d := new(big.Int).SetBytes(mustDecodeHex(t, key))
+		for _, msg := range []string{"", "claims", "another message"} {
+			hash := keccak256([]byte(msg))
+			got, err := ecrecover(hash, signForTest(t, d, hash))
+			if err != nil {
+				t.Fatalf("key %s, message %q: %v", key, msg, err)
+			}
+			if want := addressOfKey(d); got != want {
+				t.Errorf("key %s, message %q: ecrecover() = %s, want %s", key, msg, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package indexer
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Stages of a run. Errors returned by Index match one of them with errors.Is.
+var (
+	//ErrFetch is a failure fetching data from the ChainSource.
+	ErrFetch = errors.New("fetch")
+	//ErrPersist is a failure reading from or writing to the DB.
+	ErrPersist = errors.New("persist")
+	//ErrScore is a failure computing the scores of a ValidatorGroup.
+	ErrScore = errors.New("score")
+)
+
+//StageError is an error that happened during one stage of a run.
+type StageError struct {
+	Stage error  // One of ErrFetch, ErrPersist or ErrScore.
+	Op    string // What was being done when the error happened.
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("%s: %s: %v", e.Stage, e.Op, e.Err)
+}
+
+//Unwrap returns the underlying error.
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+//Is reports whether `target` is the stage the error happened in.
+func (e *StageError) Is(target error) bool {
+	return target == e.Stage
+}
+
+func fetchError(op string, err error) error {
+	return &StageError{Stage: ErrFetch, Op: op, Err: err}
+}
+
+func persistError(op string, err error) error {
+	metrics.observeDBError()
+	return &StageError{Stage: ErrPersist, Op: op, Err: err}
+}
+
+func scoreError(op string, err error) error {
+	return &StageError{Stage: ErrScore, Op: op, Err: err}
+}
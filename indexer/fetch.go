@@ -0,0 +1,83 @@
+package indexer
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+//forEachConcurrently calls `fetch` for every address, with at most `cfg.FetchWorkers` calls in flight.
+//Each call gets its own context, bounded by `cfg.RequestTimeout` and logging with the address as the group. It returns once all calls are done.
+func forEachConcurrently(ctx context.Context, addresses []string, cfg *Config, fetch func(ctx context.Context, address string)) {
+	workers := cfg.FetchWorkers
+	if workers < 1 {
+		workers = 1
+	}
+
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for address := range jobs {
+				reqCtx, cancel := requestContext(ctx, cfg.RequestTimeout)
+				fetch(withLogField(reqCtx, LogGroup, address), address)
+				cancel()
+			}
+		}()
+	}
+
+	for _, address := range addresses {
+		jobs <- address
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+func requestContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+//fetchDowntimeScores fetches the slashing multipliers of the VGs at `addresses` concurrently.
+//Addresses whose request failed are in the returned errors instead of the scores.
+func fetchDowntimeScores(ctx context.Context, src ChainSource, addresses []string, cfg *Config) (map[string]string, map[string]error) {
+	var mu sync.Mutex
+	scores := make(map[string]string, len(addresses))
+	errs := make(map[string]error)
+
+	forEachConcurrently(ctx, addresses, cfg, func(ctx context.Context, address string) {
+		score, err := src.DowntimeScore(ctx, address)
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			errs[address] = err
+			return
+		}
+		scores[address] = score
+	})
+	return scores, errs
+}
+
+//fetchEpochsRegistered fetches the epochs the VGs at `addresses` registered at concurrently.
+//Addresses whose request failed are in the returned errors instead of the epochs.
+func fetchEpochsRegistered(ctx context.Context, src ChainSource, addresses []string, cfg *Config) (map[string]EpochVGRegistered, map[string]error) {
+	var mu sync.Mutex
+	epochs := make(map[string]EpochVGRegistered, len(addresses))
+	errs := make(map[string]error)
+
+	forEachConcurrently(ctx, addresses, cfg, func(ctx context.Context, address string) {
+		epoch, err := src.EpochRegistered(ctx, address)
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			errs[address] = err
+			return
+		}
+		epochs[address] = epoch
+	})
+	return epochs, errs
+}
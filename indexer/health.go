@@ -0,0 +1,120 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+//healthCheckTimeout bounds the DB calls made by a single check.
+const healthCheckTimeout = 5 * time.Second
+
+//HealthChecker serves the liveness and readiness checks of the indexer.
+//
+//It doesn't call the upstream APIs: a probe shouldn't spend their retries, nor count towards their circuit breakers.
+type HealthChecker struct {
+	DB *pg.DB
+	// Network tells which epoch the chain is in, see Network.EpochAt.
+	Network Network
+	// MaxLag is the number of epochs the DB can be behind the chain while still ready.
+	MaxLag uint64
+	// MaxAge is how long ago the last successful run can have finished while still ready.
+	MaxAge time.Duration
+}
+
+//NewHealthChecker returns a HealthChecker for the network of `cfg`, using its readiness thresholds.
+func NewHealthChecker(DB *pg.DB, cfg *Config) (*HealthChecker, error) {
+	network, ok := cfg.NetworkProfile()
+	if !ok {
+		return nil, fmt.Errorf("health: unknown network %q", cfg.Network)
+	}
+	return &HealthChecker{DB: DB, Network: network, MaxLag: uint64(cfg.ReadyMaxLag), MaxAge: cfg.ReadyMaxAge}, nil
+}
+
+//healthStatus is the JSON body of /healthz.
+type healthStatus struct {
+	Status string `json:"status"`
+	DB     string `json:"db"`
+}
+
+//readyStatus is the JSON body of /readyz.
+type readyStatus struct {
+	Status           string     `json:"status"`
+	LastIndexedEpoch uint64     `json:"lastIndexedEpoch"`
+	CurrentEpoch     uint64     `json:"currentEpoch"`
+	Lag              uint64     `json:"lag"`
+	MaxLag           uint64     `json:"maxLag"`
+	LastSuccess      *time.Time `json:"lastSuccess"`
+	MaxAge           string     `json:"maxAge"`
+	Problems         []string   `json:"problems,omitempty"`
+}
+
+//Healthz reports whether the process is alive and the DB answers a ping.
+func (h *HealthChecker) Healthz() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+		defer cancel()
+
+		status := healthStatus{Status: "ok", DB: "ok"}
+		if err := h.DB.Ping(ctx); err != nil {
+			status.Status = "unavailable"
+			status.DB = err.Error()
+		}
+		writeStatus(w, status.Status == "ok", status)
+	})
+}
+
+//Readyz reports whether the DB is caught up with the chain: the last indexed epoch is at most MaxLag behind
+//the current epoch, and the last successful run finished less than MaxAge ago.
+//The last indexed epoch is read from the DB, and the current epoch is estimated from the clock, so neither depends on
+//a run having happened in this process.
+func (h *HealthChecker) Readyz() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+		defer cancel()
+
+		status := readyStatus{MaxLag: h.MaxLag, MaxAge: h.MaxAge.String()}
+
+		lastIndexedEpoch, err := findLastIndexedEpoch(h.DB.WithContext(ctx))
+		if err != nil && err.Error() != NoResultError {
+			status.Problems = append(status.Problems, fmt.Sprintf("find last indexed epoch: %v", err))
+		}
+		status.LastIndexedEpoch = lastIndexedEpoch.Number
+
+		status.CurrentEpoch = h.Network.EpochAt(time.Now())
+
+		if status.CurrentEpoch > status.LastIndexedEpoch {
+			status.Lag = status.CurrentEpoch - status.LastIndexedEpoch
+		}
+		if status.Lag > h.MaxLag {
+			status.Problems = append(status.Problems, fmt.Sprintf("%d epochs behind the chain, more than %d", status.Lag, h.MaxLag))
+		}
+
+		if lastSuccess := metrics.lastSuccessTime(); lastSuccess.IsZero() {
+			status.Problems = append(status.Problems, "no successful run yet")
+		} else {
+			status.LastSuccess = &lastSuccess
+			if age := time.Since(lastSuccess); age > h.MaxAge {
+				status.Problems = append(status.Problems, fmt.Sprintf("last successful run %s ago, more than %s", age.Round(time.Second), h.MaxAge))
+			}
+		}
+
+		status.Status = "ok"
+		if len(status.Problems) > 0 {
+			status.Status = "unavailable"
+		}
+		writeStatus(w, len(status.Problems) == 0, status)
+	})
+}
+
+func writeStatus(w http.ResponseWriter, ok bool, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,62 @@
+package indexer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/buidl-labs/celo-voting-validator-backend/graph/model"
+)
+
+func TestReadyzLag(t *testing.T) {
+	DB := testDB(t, (*model.Epoch)(nil))
+	// 95 blocks of 1s after genesis, the chain is in epoch 10.
+	network := Network{BlocksPerEpoch: 10, BlockTime: time.Second, GenesisTime: time.Now().Add(-95 * time.Second)}
+	h := &HealthChecker{DB: DB, Network: network, MaxLag: 1, MaxAge: time.Hour}
+
+	readyz := func() readyStatus {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h.Readyz().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var status readyStatus
+		if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+			t.Fatal(err)
+		}
+		return status
+	}
+	lagging := func(status readyStatus) bool {
+		for _, p := range status.Problems {
+			if strings.Contains(p, "behind the chain") {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Nothing indexed yet.
+	if status := readyz(); status.CurrentEpoch != 10 || status.LastIndexedEpoch != 0 || !lagging(status) {
+		t.Errorf("empty DB: %+v, want epoch 10 and lagging", status)
+	}
+
+	for _, tt := range []struct {
+		epoch   uint64
+		lag     uint64
+		lagging bool
+	}{
+		{8, 2, true},
+		{9, 1, false},
+		{10, 0, false},
+	} {
+		calendar := network.Calendar()
+		if _, err := DB.Model(&model.Epoch{Number: tt.epoch, StartBlock: calendar.FirstBlock(tt.epoch), EndBlock: calendar.LastBlock(tt.epoch)}).Insert(); err != nil {
+			t.Fatal(err)
+		}
+		status := readyz()
+		if status.LastIndexedEpoch != tt.epoch || status.Lag != tt.lag || lagging(status) != tt.lagging {
+			t.Errorf("epoch %d indexed: %+v, want a lag of %d", tt.epoch, status, tt.lag)
+		}
+	}
+}
@@ -1,247 +1,301 @@
 package indexer
 
 import (
-	"log"
+	"context"
+	"fmt"
 	"math"
 	"math/big"
-	"net/http"
 	"time"
 
 	"github.com/buidl-labs/celo-voting-validator-backend/graph/model"
 	"github.com/go-pg/pg/v10"
-	"github.com/machinebox/graphql"
 )
 
 //Index is a function that runs periodically to index the Celo chain.
-func Index(DB *pg.DB) {
+//Cancelling ctx aborts in-flight requests and stops the run before the next epoch is indexed.
+//
+//The returned error is a *StageError if the run had to stop, while the Report lists the
+//ValidatorGroups and Validators that were skipped in a run that otherwise went through.
+//Runs in other processes are kept out with an advisory lock, ErrRunInProgress is returned if one holds it.
+func Index(ctx context.Context, DB *pg.DB, src ChainSource, cfg *Config) (*Report, error) {
+	report, err := index(ctx, DB, src, cfg)
+	report.FinishedAt = time.Now()
+	metrics.observeRun(report, err)
+	return report, err
+}
 
-	log.Println("Start indexing...")
+func index(ctx context.Context, DB *pg.DB, src ChainSource, cfg *Config) (*Report, error) {
+	report := newReport()
+	ctx = withLogField(ctx, LogRunID, report.RunID)
 
-	// Clients used to fetch data from APIs.
-	httpClient := &http.Client{Timeout: 30 * time.Second}
-	gqlClient := graphql.NewClient("https://explorer.celo.org/graphiql")
+	network, ok := cfg.NetworkProfile()
+	if !ok {
+		return report, fmt.Errorf("index: unknown network %q", cfg.Network)
+	}
+	calendar := network.Calendar()
 
-	// Fetch all ValidatorGroups and Validators.
-	vgData, err := getValidatorGroupsAndValidatorsBasicData(gqlClient)
+	unlock, err := lockRun(ctx, DB)
 	if err != nil {
-		log.Println("Couldn't fetch data.")
-		log.Println(err)
-	} else {
-		log.Println("Fetched all VGs")
+		return report, err
 	}
+	defer unlock()
 
-	// Loop through all the ValidatorGroups
-	for _, vg := range vgData.CeloValidatorGroups {
-
-		// Check if VG is in DB
-		// Potential Improvement: Fetch all VGs from the DB at once, and then cross-check against that list.
-		vgFromDB := new(model.ValidatorGroup)
-		err := DB.Model(vgFromDB).Where("address = ?", vg.Account.Address).Limit(1).Select()
+	Log(ctx).Info("Start indexing")
 
-		if err != nil {
+	// Discover the ValidatorGroups and Validators that are new.
+	discoverCtx := withStage(ctx, "discover")
 
-			// If VG isn't in DB -> Add the VG to DB.
-			if err.Error() == NoResultError {
+	// Fetch all ValidatorGroups and Validators.
+	vgData, err := src.ValidatorGroups(discoverCtx)
+	if err != nil {
+		return report, fetchError("validator groups", err)
+	}
+	Log(discoverCtx).Info("Fetched all VGs", "groups", len(vgData.CeloValidatorGroups))
 
-				// Fetch the epoch VG was registered at.
-				epochRegistered, err := getEpochVGRegistered(httpClient, vg.Account.Address)
-				if err != nil {
-					log.Println(err)
-					return
-				}
+	// Load the addresses already in the DB once, and diff the fetched VGs against them.
+	discoverDB := DB.WithContext(discoverCtx)
+	knownGroups, err := knownAddresses(discoverDB, (*model.ValidatorGroup)(nil))
+	if err != nil {
+		return report, persistError("select validator group addresses", err)
+	}
 
-				vgForDB := model.ValidatorGroup{
-					Address:           vg.Account.Address,
-					Name:              vg.Account.Name,
-					EpochRegisteredAt: uint64(epochRegistered.Epoch),
-				}
+	// Find the ValidatorGroups that aren't in the DB yet.
+	var newGroups []CeloValidatorGroupAndValidatorBasicData
+	for _, vg := range vgData.CeloValidatorGroups {
+		if !knownGroups[vg.Account.Address] {
+			newGroups = append(newGroups, vg)
+		}
+	}
 
-				_, err = DB.Model(&vgForDB).Insert()
-				if err != nil {
-					log.Println(err)
-					return
-				}
+	// Fetch the epochs the new VGs were registered at, concurrently.
+	newAddresses := make([]string, 0, len(newGroups))
+	for _, vg := range newGroups {
+		newAddresses = append(newAddresses, vg.Account.Address)
+	}
+	epochsRegistered, epochRegisteredErrs := fetchEpochsRegistered(discoverCtx, src, newAddresses, cfg)
 
-				// Loop through the Validators of the ValidatorGroup
-				// Potential Improvement: Remove validators from the group that have de-registered.
-				for _, v := range vg.Affiliates.Edges {
-					// Check if Validator is in DB
-					vFromDB := new(model.Validator)
-					err := DB.Model(vFromDB).Where("address = ?", v.Node.Address).Limit(1).Select()
-
-					// If Validator isn't in DB; Insert it into the DB.
-					if err.Error() == NoResultError {
-						vForDB := model.Validator{
-							Address:          v.Node.Address,
-							Name:             v.Node.Name,
-							ValidatorGroupId: vgForDB.ID,
-						}
-						_, err := DB.Model(&vForDB).Insert()
-						if err != nil {
-							return
-						}
-					}
-				}
-			} else {
-				log.Panic(err.Error())
-				return
-			}
+	// Add the new VGs to the DB in one statement.
+	groupsForDB := make([]*model.ValidatorGroup, 0, len(newGroups))
+	for _, vg := range newGroups {
+		if err := epochRegisteredErrs[vg.Account.Address]; err != nil {
+			report.addFailure(discoverCtx, FailureGroup, vg.Account.Address, fetchError("epoch registered", err))
+			continue
 		}
-	} // Finished indexing new ValidatorGroups, and Validators.
-	log.Println("Finished looping through VGs and Vs.")
+		groupsForDB = append(groupsForDB, &model.ValidatorGroup{
+			Address:           vg.Account.Address,
+			Name:              vg.Account.Name,
+			EpochRegisteredAt: uint64(epochsRegistered[vg.Account.Address].Epoch),
+		})
+	}
+	insertedGroupIDs := make(map[string]string, len(groupsForDB))
+	groupErrs := insertBatch(discoverDB, &groupsForDB, len(groupsForDB), func(i int) interface{} { return groupsForDB[i] })
+	for i, vg := range groupsForDB {
+		if err := groupErrs[i]; err != nil {
+			report.addFailure(discoverCtx, FailureGroup, vg.Address, persistError("insert validator group", err))
+			continue
+		}
+		insertedGroupIDs[vg.Address] = vg.ID
+	}
+
+	// The Validators of all the VGs, new or not, are synced once the current epoch is known, see `syncAffiliates`.
+	Log(discoverCtx).Info("Finished discovering VGs", "new_groups", len(insertedGroupIDs))
 
 	var epochToIndexFrom uint64
-	lastIndexedEpoch, err := findLastIndexedEpoch(DB)
+	lastIndexedEpoch, err := findLastIndexedEpoch(DB.WithContext(withStage(ctx, "resume")))
 
 	if err != nil {
 		// If no Epochs are present in DB, start from Epoch 1.
 		if err.Error() == NoResultError {
 			epochToIndexFrom = 1
 		} else {
-			log.Fatal(err)
+			return report, persistError("find last indexed epoch", err)
 		}
 	} else {
 		epochToIndexFrom = lastIndexedEpoch.Number + 1
 	}
+	metrics.setLastIndexedEpoch(epochToIndexFrom - 1)
 
-	log.Println("Epoch to index from:", epochToIndexFrom)
-
-	currentEpoch, err := findCurrentEpoch(httpClient)
+	currentEpoch, err := src.CurrentEpoch(ctx)
 	if err != nil {
-		log.Println("Error fetching current epoch.")
-		return
+		return report, fetchError("current epoch", err)
+	}
+	report.CurrentEpoch = currentEpoch
+	metrics.setChainEpoch(currentEpoch)
+	Log(ctx).Info("Found epochs to index", "from", epochToIndexFrom, "current_epoch", currentEpoch)
+
+	// Epochs indexed before Elections were recorded have none, and `EpochsServed` is derived from them:
+	// backfill again from the first of them. The counts are recomputed once the backfill is done.
+	backfillFrom := epochToIndexFrom
+	missing, err := firstEpochWithoutElections(DB.WithContext(withStage(ctx, "resume")), epochToIndexFrom)
+	if err != nil && err.Error() != NoResultError {
+		return report, persistError("find epochs without elections", err)
+	}
+	if err == nil && missing.Number < backfillFrom {
+		backfillFrom = missing.Number
+		Log(ctx).Info("Rebuilding elections", "from", backfillFrom)
 	}
-	log.Println("Current epoch:", currentEpoch)
-
-	// Index prev epochs if epochToIndexFrom != currentEpoch
-	if epochToIndexFrom != currentEpoch {
-		var validatorGroupsFromDB []*model.ValidatorGroup
-		if err := DB.Model(&validatorGroupsFromDB).Select(); err != nil {
-			log.Fatal(err)
-		}
-
-		// Loop through all the epochs between epochToIndexFrom - currentEpoch
-		for epoch := epochToIndexFrom; epoch < currentEpoch; epoch++ {
-
-			// Keeps tally of which VGs have served in the Epoch.
-			vgInEpoch := make(map[string]bool)
-
-			// Used to inserting the Epoch to DB.
-			var startBlock, endBlock uint64
-
-			if epoch == 1 {
-				startBlock = 1
-				endBlock = 17280
-			} else {
-				startBlock = ((epoch - 1) * 17280) + 1
-				endBlock = (epoch * 17280)
-			}
-
-			log.Println("For epoch", epoch)
-			electedValidatorsInEpoch, err := getElectedValidatorsAtEpoch(gqlClient, epoch)
-			if err != nil {
-				log.Println("Error fetching elected validators.")
-				log.Println(err.Error())
-				return
-			}
-
-			currEpoch := model.Epoch{
-				StartBlock: startBlock,
-				EndBlock:   endBlock,
-				Number:     epoch,
-			}
-			_, err = DB.Model(&currEpoch).Insert()
-			if err != nil {
-				log.Fatal(err)
-				return
-			}
-
-			// Aggregate the VGs that were elected in this Epoch.
-			for _, v := range electedValidatorsInEpoch.CeloElectedValidators {
-				if v.CeloAccount.Validator.GroupInfo.Address != "" {
-					vgInEpoch[v.CeloAccount.Validator.GroupInfo.Address] = true
-				}
-			}
 
-			// Loop through all the VGs that have served in this epoch
-			for vg, served := range vgInEpoch {
-
-				if served {
-
-					found := false // keeps track of whether the vg we're looking for is present in the DB or not.
-					vgFromDB := new(model.ValidatorGroup)
-					// Loops through VGs from DB to find the VG we want to update.
-					for _, groupFromDB := range validatorGroupsFromDB {
-						if vg == groupFromDB.Address {
-							vgFromDB = groupFromDB
-							found = true
-							break
-						}
-					}
-
-					if found {
-						// Increment the EpochsServed and update the DB.
-						vgFromDB.EpochsServed++
-						_, err := DB.Model(vgFromDB).WherePK().Update()
-						if err != nil {
-							log.Fatalln(err)
-						}
-					}
-				}
-			}
+	// Add, move and retire Validators so that the DB matches the affiliates of the fetched VGs.
+	if err := syncAffiliates(withStage(ctx, "affiliates"), DB, currentEpoch, vgData.CeloValidatorGroups, report); err != nil {
+		return report, err
+	}
 
-			// Small pause to not overload the API we're using to fetch the ElectedValidators
-			time.Sleep(3 * time.Second)
+	// Index prev epochs if backfillFrom != currentEpoch
+	if backfillFrom < currentEpoch {
+		if err := backfillEpochs(withStage(ctx, "backfill"), DB, src, backfillFrom, currentEpoch-1, cfg, report); err != nil {
+			return report, err
 		}
-
 	}
 
 	// Index the current epoch.
-	log.Println("Index the current epoch")
+	ctx = withLogField(withStage(ctx, "current-epoch"), LogEpoch, currentEpoch)
+	Log(ctx).Info("Index the current epoch")
 
-	// `isCurrentEpochIndexedBefore` used to check whether we need to increment `EpochsServed` for the VG.
-	// Intent is to only increment `EpochsServed` for the VG if it's the first time we're indexing the epoch.
+	// `isCurrentEpochIndexedBefore` used to check whether the current Epoch needs to be inserted into the DB.
 	isCurrentEpochIndexedBefore := true
 
 	latestEpoch := new(model.Epoch)
 	// Find the model.Epoch from DB for the current epoch.
-	err = DB.Model(latestEpoch).Where("number = ?", currentEpoch).Limit(1).Select()
-	log.Println("Epoch number:", latestEpoch.Number)
+	err = DB.ModelContext(ctx, latestEpoch).Where("number = ?", currentEpoch).Limit(1).Select()
 
 	if err != nil {
-		if err.Error() == NoResultError {
-			// If current epoch isn't present in the DB, insert it into the DB.
-			isCurrentEpochIndexedBefore = false
-			latestEpoch = &model.Epoch{
-				StartBlock: ((currentEpoch - 1) * 17280) + 1,
-				EndBlock:   currentEpoch * 17280,
-				Number:     currentEpoch,
-			}
-
-			_, err = DB.Model(latestEpoch).Insert()
-			if err != nil {
-				log.Fatal(err)
-				return
-			}
+		if err.Error() != NoResultError {
+			return report, persistError("select current epoch", err)
+		}
+		// If current epoch isn't present in the DB, it's inserted along with the rest of the writes below.
+		isCurrentEpochIndexedBefore = false
+		latestEpoch = &model.Epoch{
+			StartBlock: calendar.FirstBlock(currentEpoch),
+			EndBlock:   calendar.LastBlock(currentEpoch),
+			Number:     currentEpoch,
 		}
 	}
 
 	// target yield is the parameter set by the Celo network to adjust inflation schedule
-	targetYield, _ := getTargetAPY(httpClient)
+	// If it can't be fetched the run stops here, before any of the estimated APYs are overwritten.
+	targetYield, err := src.TargetAPY(ctx)
+	if err != nil {
+		return report, fetchError("target apy", err)
+	}
 	targetYieldFloat := convertStringToBigFloat(targetYield)
-	log.Printf("%f target apy", targetYieldFloat)
+	Log(ctx).Info("Fetched target apy", "target_apy", targetYieldFloat.Text('f', 6))
 
-	details, err := getValidatorGroupsAndValidatorsDetails(gqlClient)
+	details, err := src.GroupDetails(ctx)
 	if err != nil {
-		log.Println(err)
-		return
+		return report, fetchError("group details", err)
+	}
+
+	// Validators elected in the current epoch, recorded as Elections to derive `EpochsServed` from.
+	// They're read from the details rather than from the sample block of the epoch, which the first runs of an epoch are before.
+	elections := currentElections(calendar, currentEpoch, details)
+
+	// Verify the claims of the VGs' metadata outside of the transaction below, they fill in the contact details the transparency score rewards.
+	metadata, err := syncMetadata(withStage(ctx, "metadata"), DB, src, details, cfg)
+	if err != nil {
+		return report, err
 	}
 
 	// Fetch all the VGs and Vs from the DB.
 	var validatorGroupsFromDB []*model.ValidatorGroup
-	err = DB.Model(&validatorGroupsFromDB).Relation("Validators").Select()
+	err = DB.ModelContext(ctx, &validatorGroupsFromDB).Relation("Validators").Select()
+	if err != nil {
+		return report, persistError("select validator groups", err)
+	}
+
+	// Only the current members of a VG count towards its scores, not the Validators that left it.
+	members, err := currentMembers(DB.WithContext(ctx))
+	if err != nil {
+		return report, persistError("select current members", err)
+	}
+	for _, vg := range validatorGroupsFromDB {
+		vg.Validators = currentValidators(vg.Validators, members[vg.Address])
+	}
+
+	// Fetch the slashing multipliers concurrently and up front, so the transaction below isn't held open across HTTP requests.
+	groupAddresses := make([]string, 0, len(details.CeloValidatorGroups))
+	for _, validatorGroup := range details.CeloValidatorGroups {
+		groupAddresses = append(groupAddresses, validatorGroup.Account.Address)
+	}
+	slashingScores, slashingScoreErrs := fetchDowntimeScores(ctx, src, groupAddresses, cfg)
+	for _, address := range groupAddresses {
+		if err := slashingScoreErrs[address]; err != nil {
+			report.addFailure(ctx, FailureGroup, address, fetchError("downtime score", err))
+		}
+	}
+
+	// Write the current Epoch, the stats and the updated VGs and Vs in one transaction, so the epoch is either fully indexed or not at all.
+	err = DB.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		return indexCurrentEpoch(ctx, tx, calendar, report, latestEpoch, isCurrentEpochIndexedBefore, elections, targetYieldFloat, details, validatorGroupsFromDB, slashingScores, metadata, cfg.Scoring)
+	})
 	if err != nil {
-		log.Println(err)
+		// Nothing was written, so none of the VGs count as processed.
+		report.GroupsProcessed = 0
+		return report, err
+	}
+	report.EpochsIndexed = append(report.EpochsIndexed, currentEpoch)
+	metrics.observeIndexedEpoch(currentEpoch)
+
+	return report, nil
+}
+
+//currentElections returns the Elections of `epoch`: the Validators in `details` last elected during it.
+func currentElections(calendar EpochCalendar, epoch uint64, details CeloValidatorGroupsAndValidatorsDetails) []*Election {
+	var elections []*Election
+	for _, vg := range details.CeloValidatorGroups {
+		for _, v := range vg.Affiliates.Edges {
+			if calendar.EpochOfBlock(uint64(v.Node.LastElected)) != epoch {
+				continue
+			}
+			elections = append(elections, &Election{
+				EpochNumber:      epoch,
+				ValidatorAddress: v.Node.Address,
+				GroupAddress:     vg.Account.Address,
+			})
+		}
+	}
+	return elections
+}
+
+//currentValidators returns the Validators in `validators` whose address is in `members`.
+func currentValidators(validators []*model.Validator, members map[string]bool) []*model.Validator {
+	current := make([]*model.Validator, 0, len(validators))
+	for _, v := range validators {
+		if members[v.Address] {
+			current = append(current, v)
+		}
+	}
+	return current
+}
+
+//indexCurrentEpoch writes the current round of stats for every VG and V using `tx`.
+//`latestEpoch` is inserted first if it hasn't been indexed before.
+//VGs whose score can't be computed are added to `report` and left as they were.
+func indexCurrentEpoch(ctx context.Context, tx *pg.Tx, calendar EpochCalendar, report *Report, latestEpoch *model.Epoch, isCurrentEpochIndexedBefore bool, elections []*Election, targetYieldFloat *big.Float, details CeloValidatorGroupsAndValidatorsDetails, validatorGroupsFromDB []*model.ValidatorGroup, slashingScores map[string]string, metadata map[string]*AccountMetadata, scoring ScoringConfig) error {
+	currentEpoch := latestEpoch.Number
+	if !isCurrentEpochIndexedBefore {
+		if _, err := tx.Model(latestEpoch).Insert(); err != nil {
+			return persistError("insert current epoch", err)
+		}
+	}
+
+	// Record the Elections of the current epoch; reruns within the epoch replace them, so `EpochsServed` is counted once.
+	// Until an election shows up in the details, the Elections already stored for the epoch are kept.
+	if len(elections) > 0 {
+		if err := replaceElections(tx, currentEpoch, elections); err != nil {
+			return persistError("record elections", err)
+		}
+	} else {
+		Log(ctx).Warn("No Validator elected in the current epoch yet, keeping its Elections")
+	}
+	epochsServed, err := recomputeEpochsServed(tx)
+	if err != nil {
+		return persistError("recompute epochs served", err)
+	}
+	for _, vg := range validatorGroupsFromDB {
+		vg.EpochsServed = epochsServed[vg.Address]
+	}
+	if err := releaseClaims(tx, validatorGroupsFromDB, metadata); err != nil {
+		return persistError("release claims", err)
 	}
 
 	// Loop through all the ValidatorGroups
@@ -255,7 +309,12 @@ func Index(DB *pg.DB) {
 				break
 			}
 		}
-		log.Printf("%s(%s)\n", vgFromDB.Name, vgFromDB.Address)
+		// VGs that couldn't be added to the DB during discovery are already in the report.
+		if vgFromDB.ID == "" {
+			continue
+		}
+		groupLog := Log(ctx).With(LogGroup, vgFromDB.Address)
+		groupLog.Debug("Indexing group", "name", vgFromDB.Name)
 
 		isVGCurrentlyElected := false               // Used for updating VG
 		validatorScores := make([]float64, 0, 10)   // Used for calculating `GroupScore` for the VG
@@ -281,17 +340,17 @@ func Index(DB *pg.DB) {
 				AttestationsFulfilled: validator.Node.AttestationsFulfilled,
 				LastElected:           validator.Node.LastElected,
 				Score:                 vScore,
-				EpochId:               lastIndexedEpoch.ID,
+				EpochId:               latestEpoch.ID,
 				ValidatorId:           vFromDB.ID,
 			}
-			// _, err := DB.Model(vStats).Insert()
-
-			// if err != nil {
-			// 	log.Fatal(err)
-			// }
+			if vStats.ValidatorId != "" {
+				if err := upsertValidatorStats(tx, vStats); err != nil {
+					return persistError("upsert validator stats "+vFromDB.Address, err)
+				}
+			}
 
 			// Find which is the epoch, validator was last elected in.
-			epochLastElected := getEpochFromBlock(validator.Node.LastElected)
+			epochLastElected := calendar.EpochOfBlock(uint64(validator.Node.LastElected))
 
 			if epochLastElected == currentEpoch {
 				vFromDB.CurrentlyElected = true
@@ -306,18 +365,15 @@ func Index(DB *pg.DB) {
 				attestationScores = append(attestationScores, (float64(vStats.AttestationsFulfilled) / float64(vStats.AttestationsRequested)))
 			}
 
-			_, err = DB.Model(vFromDB).WherePK().Update()
-			if err != nil {
-				log.Fatal(err)
+			if vFromDB.ID == "" {
+				continue
+			}
+			if _, err := tx.Model(vFromDB).WherePK().Update(); err != nil {
+				return persistError("update validator "+vFromDB.Address, err)
 			}
 
 		} // Finish indexing Validators under the ValidatorGroup
 
-		// If VG is currently elected, increment VG.EpochsServed
-		if isVGCurrentlyElected && !isCurrentEpochIndexedBefore {
-			vgFromDB.EpochsServed++
-		}
-
 		// Loop through the claims, set VG.WebsiteURL if claim is of type "domain"
 		for _, claim := range validatorGroup.Account.Claims.Edges {
 			if claim.Node.Type == "domain" {
@@ -325,15 +381,16 @@ func Index(DB *pg.DB) {
 				vgFromDB.VerifiedDNS = claim.Node.Verified
 			}
 		}
+		applyMetadata(vgFromDB, metadata[vgFromDB.Address])
 
 		lockedCelo := uint64(divideBy1E18(validatorGroup.Account.Group.LockedGold))
 		groupShare := divideBy1E24(validatorGroup.Account.Group.Commission)
 		votes := uint64(divideBy1E18(validatorGroup.Account.Group.Votes))
 		votingCap := uint64(divideBy1E18(validatorGroup.Account.Group.ReceivableVotes))
 
-		slashingScore, _ := getVGSlashingMultiplier(httpClient, validatorGroup.Account.Address)
-		slashingScoreFloat := float64(0)
-		if slashingScore != "" {
+		// Keep the previous slashing score if it couldn't be fetched, rather than tanking the VG's score with a 0.
+		slashingScoreFloat := vgFromDB.SlashingPenaltyScore
+		if slashingScore, ok := slashingScores[validatorGroup.Account.Address]; ok {
 			slashingScoreFloat = divideBy1E24(slashingScore)
 		}
 
@@ -372,6 +429,7 @@ func Index(DB *pg.DB) {
 			VotingCap:             votingCap,
 			AttestationPercentage: groupAttestationScore,
 			SlashingScore:         slashingScoreFloat,
+			GroupScore:            groupScore,
 			EpochId:               latestEpoch.ID,
 			ValidatorGroupId:      vgFromDB.ID,
 			EstimatedAPY:          estimatedAPYFloat,
@@ -389,17 +447,17 @@ func Index(DB *pg.DB) {
 		vgFromDB.TransparencyScore = groupTransparencyScore
 		vgFromDB.GroupShare = groupShare
 
-		// Insert VGStats for the current round.
-		// _, err = DB.Model(vgStats).Insert()
-		// if err != nil {
-		// 	log.Println(err)
-		// }
+		// Upsert VGStats for the current round, reruns within the epoch overwrite the previous snapshot.
+		if err := upsertValidatorGroupStats(tx, vgStats); err != nil {
+			return persistError("upsert validator group stats "+vgFromDB.Address, err)
+		}
 
 		// Update vgFromDB in the DB.
-		_, err = DB.Model(vgFromDB).WherePK().Update()
-		if err != nil {
-			log.Fatal(err)
+		if _, err := tx.Model(vgFromDB).WherePK().Update(); err != nil {
+			return persistError("update validator group "+vgFromDB.Address, err)
 		}
+		report.GroupsProcessed++
+		groupLog.Debug("Indexed group", "group_score", groupScore, "estimated_apy", estimatedAPYFloat)
 
 	}
 
@@ -413,7 +471,9 @@ func Index(DB *pg.DB) {
 		maxLockedCeloByNumValidators = math.Max(val, maxLockedCeloByNumValidators)
 	}
 
-	// Calculate (LockedCelo/NumValidators)Percentile and Performance Score for each VG.
+	// Calculate (LockedCelo/NumValidators)Percentile and Performance Score for each VG, with every scoring model.
+	scoreCtx := withStage(ctx, "score")
+	var performanceScores []*PerformanceScore
 	for _, vg := range validatorGroupsFromDB {
 		VGLockedCeloByNumValidators, ok := lockedCeloByNumValidatorsPerVG[vg.Address]
 		if !ok {
@@ -422,13 +482,80 @@ func Index(DB *pg.DB) {
 
 		vg.LockedCeloPercentile = VGLockedCeloByNumValidators / maxLockedCeloByNumValidators
 
-		vgPerformanceScore := calculatePerformanceScore(vg, float64(currentEpoch))
+		scores := make(map[string]float64, len(scoring.Models))
+		for _, m := range scoring.Models {
+			scores[m.Version] = m.score(vg, float64(currentEpoch))
+		}
+
+		// Only the active model's score is written to the VG.
+		vgPerformanceScore := scores[scoring.Active]
+		if math.IsNaN(vg.LockedCeloPercentile) || math.IsNaN(vgPerformanceScore) || math.IsInf(vgPerformanceScore, 0) {
+			report.addFailure(scoreCtx, FailureGroup, vg.Address, scoreError("performance score", fmt.Errorf("got %f with model %s", vgPerformanceScore, scoring.Active)))
+			continue
+		}
 		vg.PerformanceScore = vgPerformanceScore
 
-		_, err := DB.Model(vg).WherePK().Update()
+		if _, err := tx.ModelContext(scoreCtx, vg).WherePK().Update(); err != nil {
+			return persistError("update performance score "+vg.Address, err)
+		}
+
+		for _, m := range scoring.Models {
+			score := scores[m.Version]
+			if math.IsNaN(score) || math.IsInf(score, 0) {
+				Log(scoreCtx).Warn("Skipped performance score", LogGroup, vg.Address, "model", m.Version, "score", score)
+				continue
+			}
+			performanceScores = append(performanceScores, &PerformanceScore{
+				EpochNumber:  currentEpoch,
+				GroupAddress: vg.Address,
+				ModelVersion: m.Version,
+				Score:        score,
+				Active:       m.Version == scoring.Active,
+			})
+		}
+	}
+
+	// Store the score of every model along with its version, reruns within the epoch overwrite the previous ones.
+	if len(performanceScores) > 0 {
+		_, err := tx.ModelContext(scoreCtx, &performanceScores).
+			OnConflict("(epoch_number, group_address, model_version) DO UPDATE").
+			Set("score = EXCLUDED.score").
+			Set("active = EXCLUDED.active").
+			Insert()
 		if err != nil {
-			log.Fatal("Couldn't update VG.")
+			return persistError("upsert performance scores", err)
 		}
 	}
 
+	return nil
+}
+
+//storePastEpoch stores `epoch` and the Elections in it, all-or-nothing, so that `findLastIndexedEpoch` never sees
+//an Epoch whose Elections were only partially stored. An Epoch that's already in the DB keeps its row and has its
+//Elections replaced. `EpochsServed` isn't recomputed, see `backfillEpochs`.
+//
+//Every epoch has Validators elected, so an epoch without any Election is a bad response and isn't stored: it would
+//otherwise be taken for an Epoch indexed before Elections were recorded, and rebuilt on every run.
+func storePastEpoch(ctx context.Context, DB *pg.DB, calendar EpochCalendar, epoch uint64, electedValidatorsInEpoch ElectedValidatorsAtEpoch) error {
+	currEpoch := &model.Epoch{
+		StartBlock: calendar.FirstBlock(epoch),
+		EndBlock:   calendar.LastBlock(epoch),
+		Number:     epoch,
+	}
+	elections := electionsAt(epoch, electedValidatorsInEpoch)
+	if len(elections) == 0 {
+		return fetchError(fmt.Sprintf("elected validators at epoch %d", epoch),
+			fmt.Errorf("%w: no Validator elected with a group", ErrMalformedResponse))
+	}
+
+	err := DB.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		if err := upsertEpoch(tx, currEpoch); err != nil {
+			return err
+		}
+		return replaceElections(tx, epoch, elections)
+	})
+	if err != nil {
+		return persistError(fmt.Sprintf("index epoch %d", epoch), err)
+	}
+	return nil
 }
@@ -0,0 +1,107 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestElectionsAt(t *testing.T) {
+	var elected ElectedValidatorsAtEpoch
+	err := json.Unmarshal([]byte(`{"celoElectedValidators": [
+		{"celoAccount": {"address": "0xvalidator1", "validator": {"groupInfo": {"address": "0xgroup1"}}}},
+		{"celoAccount": {"address": "0xvalidator2", "validator": {"groupInfo": {"address": ""}}}},
+		{"celoAccount": {"address": "0xvalidator3", "validator": {"groupInfo": {"address": "0xgroup2"}}}}
+	]}`), &elected)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []Election
+	for _, e := range electionsAt(7, elected) {
+		got = append(got, *e)
+	}
+	want := []Election{
+		{EpochNumber: 7, ValidatorAddress: "0xvalidator1", GroupAddress: "0xgroup1"},
+		{EpochNumber: 7, ValidatorAddress: "0xvalidator3", GroupAddress: "0xgroup2"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("electionsAt() = %+v, want %+v", got, want)
+	}
+}
+
+func TestStorePastEpochWithoutElections(t *testing.T) {
+	tests := []struct {
+		name    string
+		elected string
+	}{
+		{"nobody elected", `{"celoElectedValidators": []}`},
+		{"no group", `{"celoElectedValidators": [{"celoAccount": {"address": "0xvalidator1"}}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var elected ElectedValidatorsAtEpoch
+			if err := json.Unmarshal([]byte(tt.elected), &elected); err != nil {
+				t.Fatal(err)
+			}
+			// The epoch is rejected before the DB is used.
+			err := storePastEpoch(context.Background(), nil, Networks["mainnet"].Calendar(), 7, elected)
+			if !errors.Is(err, ErrFetch) || !errors.Is(err, ErrMalformedResponse) {
+				t.Errorf("storePastEpoch() error = %v, want a malformed response", err)
+			}
+		})
+	}
+}
+
+func TestCurrentElectionsFromFixtures(t *testing.T) {
+	src := loadTestFixtures(t)
+	details, err := src.GroupDetails(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	calendar := Networks["mainnet"].Calendar()
+
+	tests := []struct {
+		epoch     uint64
+		elections []Election
+	}{
+		// Validator 2 was last elected in epoch 8, it isn't elected in the current epoch.
+		{10, []Election{
+			{EpochNumber: 10, ValidatorAddress: "0xvalidator1", GroupAddress: "0xgroup1"},
+			{EpochNumber: 10, ValidatorAddress: "0xvalidator3", GroupAddress: "0xgroup2"},
+		}},
+		// The details only tell who's elected in the epoch their lastElected block is in.
+		{9, nil},
+	}
+	for _, tt := range tests {
+		var got []Election
+		for _, e := range currentElections(calendar, tt.epoch, details) {
+			got = append(got, *e)
+		}
+		sort.Slice(got, func(i, j int) bool { return got[i].ValidatorAddress < got[j].ValidatorAddress })
+		if !reflect.DeepEqual(got, tt.elections) {
+			t.Errorf("currentElections(%d) = %+v, want %+v", tt.epoch, got, tt.elections)
+		}
+	}
+}
+
+func TestUnknownNetwork(t *testing.T) {
+	cfg := validConfig()
+	cfg.Network = "unknown"
+	ctx := context.Background()
+
+	// The network is checked before the DB or the source are used.
+	if _, err := index(ctx, nil, nil, cfg); err == nil || !strings.Contains(err.Error(), `unknown network "unknown"`) {
+		t.Errorf("index() error = %v, want an unknown network", err)
+	}
+	if err := backfillEpochs(ctx, nil, nil, 1, 2, cfg, newReport()); err == nil || !strings.Contains(err.Error(), `unknown network "unknown"`) {
+		t.Errorf("backfillEpochs() error = %v, want an unknown network", err)
+	}
+	if _, err := NewExplorerSource(cfg); err == nil || !strings.Contains(err.Error(), `unknown network "unknown"`) {
+		t.Errorf("NewExplorerSource() error = %v, want an unknown network", err)
+	}
+}
@@ -0,0 +1,40 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-pg/pg/v10"
+)
+
+//ErrRunInProgress is returned when another process is already indexing the same network in the DB.
+var ErrRunInProgress = errors.New("another run is in progress")
+
+//runLockKey is the first key of the advisory lock held during a run, the second one is the hash of the network's schema.
+const runLockKey = 0x63656c6f // "celo"
+
+//lockRun takes the advisory lock of the network's schema, so that runs of `index` and `reindex` in other processes
+//don't write to it at the same time. It returns ErrRunInProgress if the lock is held, and otherwise the func releasing it.
+//
+//Advisory locks belong to a session, so the lock is taken and released on a connection set aside for the run.
+func lockRun(ctx context.Context, DB *pg.DB) (func(), error) {
+	conn := DB.Conn()
+	var locked bool
+	_, err := conn.QueryOneContext(ctx, pg.Scan(&locked), "SELECT pg_try_advisory_lock(?, hashtext(current_schema()))", runLockKey)
+	if err != nil {
+		conn.Close()
+		return nil, persistError("take run lock", err)
+	}
+	if !locked {
+		conn.Close()
+		return nil, ErrRunInProgress
+	}
+
+	return func() {
+		// The run's ctx may be cancelled already, the lock has to be released either way.
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock(?, hashtext(current_schema()))", runLockKey); err != nil {
+			Log(ctx).Warn("Couldn't release run lock", "error", err)
+		}
+		conn.Close()
+	}, nil
+}
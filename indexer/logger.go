@@ -0,0 +1,245 @@
+package indexer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Level is the severity of a log line.
+type Level int
+
+// Levels of a Logger, in increasing order of severity.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+//ParseLevel returns the Level called `name`, one of debug, info, warn and error.
+func ParseLevel(name string) (Level, error) {
+	for i, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return Level(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q, expected one of: %s", name, strings.Join(levelNames, ", "))
+}
+
+// Keys of the fields the indexer tags its log lines with.
+const (
+	LogRunID = "run_id"
+	LogEpoch = "epoch"
+	LogGroup = "group"
+	LogStage = "stage"
+)
+
+//Logger writes leveled log lines, as text or JSON, each tagged with the fields added with With.
+//A Logger is safe for concurrent use; loggers derived from the same one share its output.
+type Logger struct {
+	out    *syncWriter
+	level  Level
+	json   bool
+	fields []logField
+}
+
+type logField struct {
+	key   string
+	value interface{}
+}
+
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+//NewLogger returns a Logger that writes the lines of at least `level` to `out`, as JSON objects if `json` is set.
+func NewLogger(out io.Writer, level Level, json bool) *Logger {
+	return &Logger{out: &syncWriter{w: out}, level: level, json: json}
+}
+
+//defaultLogger is used when the context doesn't carry a Logger.
+var defaultLogger = NewLogger(os.Stderr, LevelInfo, false)
+
+//With returns a Logger that adds `key=value` to every line, after the fields of `l`.
+func (l *Logger) With(key string, value interface{}) *Logger {
+	fields := make([]logField, len(l.fields), len(l.fields)+1)
+	copy(fields, l.fields)
+	derived := *l
+	derived.fields = append(fields, logField{key, value})
+	return &derived
+}
+
+//Debug logs `msg` with the key-value pairs `kv` at LevelDebug.
+func (l *Logger) Debug(msg string, kv ...interface{}) { l.log(LevelDebug, msg, kv) }
+
+//Info logs `msg` with the key-value pairs `kv` at LevelInfo.
+func (l *Logger) Info(msg string, kv ...interface{}) { l.log(LevelInfo, msg, kv) }
+
+//Warn logs `msg` with the key-value pairs `kv` at LevelWarn.
+func (l *Logger) Warn(msg string, kv ...interface{}) { l.log(LevelWarn, msg, kv) }
+
+//Error logs `msg` with the key-value pairs `kv` at LevelError.
+func (l *Logger) Error(msg string, kv ...interface{}) { l.log(LevelError, msg, kv) }
+
+func (l *Logger) log(level Level, msg string, kv []interface{}) {
+	if level < l.level {
+		return
+	}
+	fields := l.fields
+	if len(kv) > 0 {
+		fields = append(fields[:len(fields):len(fields)], pairs(kv)...)
+	}
+
+	var line []byte
+	if l.json {
+		line = formatJSON(time.Now(), level, msg, fields)
+	} else {
+		line = formatText(time.Now(), level, msg, fields)
+	}
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	l.out.w.Write(line)
+}
+
+//pairs turns alternating keys and values into fields. A key without a value gets "!MISSING".
+func pairs(kv []interface{}) []logField {
+	fields := make([]logField, 0, (len(kv)+1)/2)
+	for i := 0; i < len(kv); i += 2 {
+		key := fmt.Sprint(kv[i])
+		var value interface{} = "!MISSING"
+		if i+1 < len(kv) {
+			value = kv[i+1]
+		}
+		fields = append(fields, logField{key, value})
+	}
+	return fields
+}
+
+func formatText(t time.Time, level Level, msg string, fields []logField) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %-5s %s", t.Format(time.RFC3339), strings.ToUpper(level.String()), msg)
+	for _, f := range fields {
+		value := fmt.Sprint(logValue(f.value))
+		if strings.ContainsAny(value, " \t\n\"=") || value == "" {
+			value = fmt.Sprintf("%q", value)
+		}
+		fmt.Fprintf(&b, " %s=%s", f.key, value)
+	}
+	b.WriteByte('\n')
+	return []byte(b.String())
+}
+
+func formatJSON(t time.Time, level Level, msg string, fields []logField) []byte {
+	// Encoded by hand rather than through a map, so that the fields keep their order.
+	var b strings.Builder
+	b.WriteString("{")
+	writeJSONField(&b, "time", t.Format(time.RFC3339Nano))
+	b.WriteString(",")
+	writeJSONField(&b, "level", level.String())
+	b.WriteString(",")
+	writeJSONField(&b, "msg", msg)
+	for _, f := range fields {
+		b.WriteString(",")
+		writeJSONField(&b, f.key, logValue(f.value))
+	}
+	b.WriteString("}\n")
+	return []byte(b.String())
+}
+
+func writeJSONField(b *strings.Builder, key string, value interface{}) {
+	k, _ := json.Marshal(key)
+	v, err := json.Marshal(value)
+	if err != nil {
+		v, _ = json.Marshal(fmt.Sprint(value))
+	}
+	b.Write(k)
+	b.WriteString(":")
+	b.Write(v)
+}
+
+//logValue turns the values that don't marshal to something useful, like errors, into strings.
+func logValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case error:
+		return v.Error()
+	case time.Duration:
+		return v.String()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return value
+}
+
+//Writer returns an io.Writer that logs each line written to it at LevelInfo, so that the standard
+//library's log package can be routed through `l` with log.SetOutput.
+func (l *Logger) Writer() io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		l.Info(strings.TrimRight(string(p), "\n"))
+		return len(p), nil
+	})
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+type loggerKey struct{}
+
+//WithLogger returns a copy of ctx carrying `l`.
+func WithLogger(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+//Log returns the Logger carried by ctx, or a default one writing text to stderr.
+func Log(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*Logger); ok {
+		return l
+	}
+	return defaultLogger
+}
+
+//withLogField returns a copy of ctx whose Logger adds `key=value` to every line.
+func withLogField(ctx context.Context, key string, value interface{}) context.Context {
+	return WithLogger(ctx, Log(ctx).With(key, value))
+}
+
+type stageKey struct{}
+
+//withStage returns a copy of ctx for the stage of a run called `stage`, whose Logger tags every line with it.
+func withStage(ctx context.Context, stage string) context.Context {
+	return withLogField(context.WithValue(ctx, stageKey{}, stage), LogStage, stage)
+}
+
+//stageOf returns the stage of a run ctx is for, "" outside of one.
+func stageOf(ctx context.Context) string {
+	stage, _ := ctx.Value(stageKey{}).(string)
+	return stage
+}
+
+//newRunID returns a random ID to correlate the log lines of a run.
+func newRunID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,284 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/buidl-labs/celo-voting-validator-backend/graph/model"
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+// Types of the claims of an account's metadata that are kept in AccountMetadata. Other claims are ignored.
+const (
+	ClaimKeybase  = "KEYBASE"
+	ClaimTwitter  = "TWITTER"
+	ClaimDiscord  = "DISCORD"
+	ClaimEmail    = "EMAIL"
+	ClaimLocation = "LOCATION"
+)
+
+//ErrUnsignedMetadata is returned when the claims of an account's metadata aren't signed by the account.
+var ErrUnsignedMetadata = errors.New("metadata not signed by the account")
+
+//metadataDocument is the metadata an account publishes at its metadata URL: a list of claims, signed by the account.
+type metadataDocument struct {
+	Claims []json.RawMessage `json:"claims"`
+	Meta   struct {
+		Address   string `json:"address"`
+		Signature string `json:"signature"`
+	} `json:"meta"`
+}
+
+//metadataClaim holds the fields of the claims that are kept, each type of claim sets one of them.
+type metadataClaim struct {
+	Type     string `json:"type"`
+	Username string `json:"username"` // KEYBASE, TWITTER and DISCORD.
+	Email    string `json:"email"`
+	Location string `json:"location"`
+}
+
+//parseMetadata returns the claims of the metadata document `raw` published by the account at `address`,
+//once its signature is verified. When a type of claim appears more than once, the last one wins.
+func parseMetadata(raw []byte, address string) (*AccountMetadata, error) {
+	doc := new(metadataDocument)
+	if err := json.Unmarshal(raw, doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedResponse, err)
+	}
+	if err := verifyMetadata(doc, address); err != nil {
+		return nil, err
+	}
+
+	metadata := &AccountMetadata{Address: address}
+	for _, raw := range doc.Claims {
+		var claim metadataClaim
+		if err := json.Unmarshal(raw, &claim); err != nil {
+			return nil, fmt.Errorf("%w: claim %s: %v", ErrMalformedResponse, raw, err)
+		}
+		switch strings.ToUpper(claim.Type) {
+		case ClaimKeybase:
+			metadata.Keybase = strings.TrimSpace(claim.Username)
+		case ClaimTwitter:
+			metadata.Twitter = strings.TrimPrefix(strings.TrimSpace(claim.Username), "@")
+		case ClaimDiscord:
+			metadata.Discord = strings.TrimSpace(claim.Username)
+		case ClaimEmail:
+			metadata.Email = strings.TrimSpace(claim.Email)
+		case ClaimLocation:
+			metadata.Location = strings.TrimSpace(claim.Location)
+		}
+	}
+	return metadata, nil
+}
+
+//verifyMetadata checks that the claims of `doc` are signed by the account at `address`.
+//
+//Claims are hashed the way contractkit's IdentityMetadataWrapper does: each claim is serialised as compact JSON
+//and hashed, and the hex encoded hashes are concatenated and hashed again. That hash is signed as an Ethereum
+//personal message, whose length prefix contractkit counts in bytes or in hex characters, and the signature can
+//be serialised as r ‖ s ‖ v or v ‖ r ‖ s, all of which are accepted.
+//
+//Only the account's own key is accepted: contractkit also accepts the signers the account authorised in the
+//Accounts contract, which the indexer doesn't read, so metadata signed by one of them is rejected.
+func verifyMetadata(doc *metadataDocument, address string) error {
+	if !strings.EqualFold(doc.Meta.Address, address) {
+		return fmt.Errorf("%w: metadata is for %q", ErrUnsignedMetadata, doc.Meta.Address)
+	}
+	sig, err := hex.DecodeString(strings.TrimPrefix(doc.Meta.Signature, "0x"))
+	if err != nil || len(sig) != 65 {
+		return fmt.Errorf("%w: signature %q isn't 65 hex encoded bytes", ErrMalformedResponse, doc.Meta.Signature)
+	}
+
+	hash, err := hashOfClaims(doc.Claims)
+	if err != nil {
+		return err
+	}
+
+	vrs := append(append([]byte(nil), sig[1:]...), sig[0])
+	for _, digest := range [][]byte{
+		keccak256([]byte("\x19Ethereum Signed Message:\n32"), hash),
+		keccak256([]byte("\x19Ethereum Signed Message:\n66"), hash),
+	} {
+		for _, sig := range [][]byte{sig, vrs} {
+			signer, err := ecrecover(digest, sig)
+			if err == nil && strings.EqualFold(signer, address) {
+				return nil
+			}
+		}
+	}
+	return ErrUnsignedMetadata
+}
+
+//hashOfClaims returns the hash of `claims` that the metadata signature is over, see verifyMetadata.
+func hashOfClaims(claims []json.RawMessage) ([]byte, error) {
+	var hashes strings.Builder
+	for _, claim := range claims {
+		var serialized bytes.Buffer
+		if err := json.Compact(&serialized, claim); err != nil {
+			return nil, fmt.Errorf("%w: claim %s: %v", ErrMalformedResponse, claim, err)
+		}
+		hashes.WriteString("0x" + hex.EncodeToString(keccak256(serialized.Bytes())))
+	}
+	return keccak256([]byte(hashes.String())), nil
+}
+
+//syncMetadata fetches the metadata of the ValidatorGroups in `details` concurrently, and stores the claims
+//whose signature is verified. It returns the AccountMetadata stored by address: a VG whose metadata couldn't be
+//fetched or verified keeps the claims verified last, and a VG that doesn't publish metadata anymore has none.
+func syncMetadata(ctx context.Context, DB *pg.DB, src ChainSource, details CeloValidatorGroupsAndValidatorsDetails, cfg *Config) (map[string]*AccountMetadata, error) {
+	urls := make(map[string]string, len(details.CeloValidatorGroups))
+	var published, unpublished []string
+	for _, vg := range details.CeloValidatorGroups {
+		if vg.Account.URL == "" {
+			unpublished = append(unpublished, vg.Account.Address)
+			continue
+		}
+		urls[vg.Account.Address] = vg.Account.URL
+		published = append(published, vg.Account.Address)
+	}
+
+	var mu sync.Mutex
+	verified := make([]*AccountMetadata, 0, len(published))
+	forEachConcurrently(ctx, published, cfg, func(ctx context.Context, address string) {
+		url := urls[address]
+		raw, err := src.AccountMetadata(ctx, url)
+		if err != nil {
+			Log(ctx).Warn("Couldn't fetch account metadata", "url", url, "error", err)
+			return
+		}
+		metadata, err := parseMetadata(raw, address)
+		if err != nil {
+			Log(ctx).Warn("Couldn't verify account metadata", "url", url, "error", err)
+			return
+		}
+		metadata.URL = url
+		metadata.LastVerified = time.Now()
+		mu.Lock()
+		defer mu.Unlock()
+		verified = append(verified, metadata)
+	})
+
+	db := DB.WithContext(ctx)
+	if len(verified) > 0 {
+		_, err := db.Model(&verified).
+			OnConflict("(address) DO UPDATE").
+			Set("url = EXCLUDED.url").
+			Set("keybase = EXCLUDED.keybase").
+			Set("twitter = EXCLUDED.twitter").
+			Set("discord = EXCLUDED.discord").
+			Set("email = EXCLUDED.email").
+			Set("location = EXCLUDED.location").
+			Set("last_verified = EXCLUDED.last_verified").
+			Insert()
+		if err != nil {
+			return nil, persistError("upsert account metadata", err)
+		}
+	}
+	if len(unpublished) > 0 {
+		_, err := db.Model((*AccountMetadata)(nil)).Where("address IN (?)", pg.In(unpublished)).Delete()
+		if err != nil {
+			return nil, persistError("delete account metadata", err)
+		}
+	}
+
+	var stored []*AccountMetadata
+	if err := db.Model(&stored).Select(); err != nil {
+		return nil, persistError("select account metadata", err)
+	}
+	metadata := make(map[string]*AccountMetadata, len(stored))
+	for _, m := range stored {
+		metadata[m.Address] = m
+	}
+	dropSharedClaims(ctx, metadata)
+
+	Log(ctx).Info("Synced account metadata", "verified", len(verified), "published", len(published))
+	return metadata, nil
+}
+
+//uniqueClaims are the claims whose column is unique among ValidatorGroups.
+var uniqueClaims = []struct {
+	name   string
+	column string // Column of validator_groups.
+	value  func(m *AccountMetadata) *string
+	field  func(vg *model.ValidatorGroup) *string
+}{
+	{"email", "email", func(m *AccountMetadata) *string { return &m.Email }, func(vg *model.ValidatorGroup) *string { return &vg.Email }},
+	{"twitter", "twitter_username", func(m *AccountMetadata) *string { return &m.Twitter }, func(vg *model.ValidatorGroup) *string { return &vg.TwitterUsername }},
+	{"discord", "discord_tag", func(m *AccountMetadata) *string { return &m.Discord }, func(vg *model.ValidatorGroup) *string { return &vg.DiscordTag }},
+}
+
+//dropSharedClaims clears the emails, Twitter usernames and Discord tags claimed by more than one account in `metadata`,
+//as they're unique among ValidatorGroups and can't be attributed to either of them.
+func dropSharedClaims(ctx context.Context, metadata map[string]*AccountMetadata) {
+	for _, claim := range uniqueClaims {
+		claimedBy := make(map[string][]string)
+		for address, m := range metadata {
+			if v := strings.ToLower(*claim.value(m)); v != "" {
+				claimedBy[v] = append(claimedBy[v], address)
+			}
+		}
+		for value, addresses := range claimedBy {
+			if len(addresses) < 2 {
+				continue
+			}
+			sort.Strings(addresses)
+			Log(ctx).Warn("Ignoring claim shared by several accounts", "claim", claim.name, "value", value, "accounts", strings.Join(addresses, ","))
+			for _, address := range addresses {
+				*claim.value(metadata[address]) = ""
+			}
+		}
+	}
+}
+
+//applyMetadata sets the contact details of `vg` from its verified claims, clearing the ones it doesn't claim.
+func applyMetadata(vg *model.ValidatorGroup, metadata *AccountMetadata) {
+	if metadata == nil {
+		metadata = new(AccountMetadata)
+	}
+	vg.Email = metadata.Email
+	vg.TwitterUsername = metadata.Twitter
+	vg.DiscordTag = metadata.Discord
+	vg.GeographicLocation = metadata.Location
+}
+
+//releaseClaims clears the emails, Twitter usernames and Discord tags of `groups` that another ValidatorGroup claims in
+//`metadata`, both in `groups` and in the DB. They're unique among ValidatorGroups, so a claim that moved to another
+//ValidatorGroup since the last run is released by the one holding it before any of them is updated.
+func releaseClaims(DB orm.DB, groups []*model.ValidatorGroup, metadata map[string]*AccountMetadata) error {
+	for _, claim := range uniqueClaims {
+		claimedBy := make(map[string]string, len(metadata))
+		for address, m := range metadata {
+			if v := strings.ToLower(*claim.value(m)); v != "" {
+				claimedBy[v] = address
+			}
+		}
+
+		var released []string
+		for _, vg := range groups {
+			v := claim.field(vg)
+			if address, ok := claimedBy[strings.ToLower(*v)]; ok && *v != "" && address != vg.Address {
+				*v = ""
+				released = append(released, vg.ID)
+			}
+		}
+		if len(released) == 0 {
+			continue
+		}
+		_, err := DB.Model((*model.ValidatorGroup)(nil)).
+			Set("? = NULL", pg.Ident(claim.column)).
+			WhereIn("id IN (?)", released).
+			Update()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/buidl-labs/celo-voting-validator-backend/graph/model"
+)
+
+//metadataKey is go-ethereum's crypto test key, the account publishing the metadata in these tests.
+const metadataKey = "289c2857d4598e37fb9647507e47a309d6133539bf21a8b9cb6df88fd5232032"
+
+//metadataClaims are claims serialised the way contractkit's IdentityMetadataWrapper hashes them, by JSON.stringify.
+var metadataClaims = []string{
+	`{"name":"Test Group","timestamp":1596563200,"type":"NAME"}`,
+	`{"timestamp":1596563201,"type":"KEYBASE","username":" testgroup "}`,
+	`{"timestamp":1596563202,"type":"TWITTER","username":"@testgroup"}`,
+	`{"email":"ops@testgroup.example","timestamp":1596563203,"type":"EMAIL"}`,
+	`{"domain":"testgroup.example","timestamp":1596563204,"type":"DOMAIN"}`,
+	`{"location":"Berlin","timestamp":1596563205,"type":"LOCATION"}`,
+}
+
+//signedMetadata returns a metadata document with `claims`, published by the account of `key`, indented the way
+//IdentityMetadataWrapper.toString writes it. The claims hash is computed here rather than with hashOfClaims: the
+//keccak256 of each serialised claim, hex encoded with 0x and concatenated, is hashed again. The signature is over that
+//hash prefixed with a length of `prefixLength`, and serialised as v ‖ r ‖ s when `vrs` is set.
+func signedMetadata(t *testing.T, key string, claims []string, prefixLength int, vrs bool) (doc []byte, address string) {
+	t.Helper()
+	d := new(big.Int).SetBytes(mustDecodeHex(t, key))
+	address = addressOfKey(d)
+
+	var hashes string
+	for _, c := range claims {
+		hashes += "0x" + hex.EncodeToString(keccak256([]byte(c)))
+	}
+	sig := signForTest(t, d, keccak256([]byte(fmt.Sprintf("\x19Ethereum Signed Message:\n%d", prefixLength)), keccak256([]byte(hashes))))
+	if vrs {
+		sig = append(sig[64:], sig[:64]...)
+	}
+
+	compact := fmt.Sprintf(`{"claims":[%s],"meta":{"address":"%s","signature":"0x%s"}}`,
+		strings.Join(claims, ","), strings.ToUpper(address[:2])+address[2:], hex.EncodeToString(sig))
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, []byte(compact), "", "  "); err != nil {
+		t.Fatal(err)
+	}
+	return indented.Bytes(), address
+}
+
+func TestParseMetadata(t *testing.T) {
+	want := AccountMetadata{
+		Keybase:  "testgroup",
+		Twitter:  "testgroup",
+		Email:    "ops@testgroup.example",
+		Location: "Berlin",
+	}
+	tests := []struct {
+		name         string
+		prefixLength int
+		vrs          bool
+	}{
+		// contractkit serialises signatures as v ‖ r ‖ s, and verifies them against the hash prefixed
+		// with the length of its hex encoding.
+		{"contractkit", 66, true},
+		{"eth_sign", 32, false},
+		{"eth_sign, v first", 32, true},
+		{"hex length, r first", 66, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, address := signedMetadata(t, metadataKey, metadataClaims, tt.prefixLength, tt.vrs)
+			got, err := parseMetadata(doc, address)
+			if err != nil {
+				t.Fatalf("parseMetadata() error = %v", err)
+			}
+			want := want
+			want.Address = address
+			if *got != want {
+				t.Errorf("parseMetadata() = %+v, want %+v", *got, want)
+			}
+		})
+	}
+}
+
+func TestParseMetadataLastClaimWins(t *testing.T) {
+	claims := append(append([]string(nil), metadataClaims...), `{"location":"Lisbon","timestamp":1596563206,"type":"LOCATION"}`)
+	doc, address := signedMetadata(t, metadataKey, claims, 66, true)
+	got, err := parseMetadata(doc, address)
+	if err != nil {
+		t.Fatalf("parseMetadata() error = %v", err)
+	}
+	if got.Location != "Lisbon" {
+		t.Errorf("Location = %q, want %q", got.Location, "Lisbon")
+	}
+}
+
+func TestParseMetadataRejected(t *testing.T) {
+	doc, address := signedMetadata(t, metadataKey, metadataClaims, 66, true)
+	otherDoc, otherAddress := signedMetadata(t, "01", metadataClaims, 66, true)
+
+	tampered := strings.Replace(string(doc), "Berlin", "Paris", 1)
+	// The document claims to be the account's, but is signed by another key.
+	forged := strings.Replace(string(otherDoc), otherAddress[2:], strings.ToUpper(address[2:]), 1)
+	var parsed metadataDocument
+	if err := json.Unmarshal(doc, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	badSignature := strings.Replace(string(doc), parsed.Meta.Signature, parsed.Meta.Signature[:len(parsed.Meta.Signature)-2], 1)
+
+	tests := []struct {
+		name    string
+		doc     string
+		address string
+		err     error
+	}{
+		{"other account", string(doc), otherAddress, ErrUnsignedMetadata},
+		{"tampered claim", tampered, address, ErrUnsignedMetadata},
+		{"signed by another key", forged, address, ErrUnsignedMetadata},
+		{"short signature", badSignature, address, ErrMalformedResponse},
+		{"not JSON", "<html></html>", address, ErrMalformedResponse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseMetadata([]byte(tt.doc), tt.address); !errors.Is(err, tt.err) {
+				t.Errorf("parseMetadata() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestDropSharedClaims(t *testing.T) {
+	metadata := map[string]*AccountMetadata{
+		"0x1": {Address: "0x1", Email: "ops@example.com", Twitter: "one", Discord: "shared#1", Location: "Berlin"},
+		"0x2": {Address: "0x2", Email: "OPS@example.com", Twitter: "two", Discord: "shared#1", Location: "Berlin"},
+		"0x3": {Address: "0x3", Email: "three@example.com", Twitter: "one"},
+	}
+	dropSharedClaims(context.Background(), metadata)
+
+	want := map[string]AccountMetadata{
+		"0x1": {Address: "0x1", Location: "Berlin"},
+		"0x2": {Address: "0x2", Twitter: "two", Location: "Berlin"},
+		"0x3": {Address: "0x3", Email: "three@example.com"},
+	}
+	for address, m := range want {
+		if *metadata[address] != m {
+			t.Errorf("metadata of %s = %+v, want %+v", address, *metadata[address], m)
+		}
+	}
+}
+
+func TestReleaseClaimsKept(t *testing.T) {
+	groups := []*model.ValidatorGroup{
+		{ID: "id-1", Address: "0x1", Email: "ops@example.com", TwitterUsername: "one"},
+		{ID: "id-2", Address: "0x2", DiscordTag: "two#2"},
+	}
+	metadata := map[string]*AccountMetadata{
+		"0x1": {Address: "0x1", Email: "OPS@example.com"},
+		"0x2": {Address: "0x2", Twitter: "two"},
+	}
+	// Nothing is released, so the DB isn't used.
+	if err := releaseClaims(nil, groups, metadata); err != nil {
+		t.Fatal(err)
+	}
+	if groups[0].Email != "ops@example.com" || groups[0].TwitterUsername != "one" || groups[1].DiscordTag != "two#2" {
+		t.Errorf("releaseClaims() changed claims no other group makes: %+v, %+v", *groups[0], *groups[1])
+	}
+}
+
+func TestReleaseClaimsMoved(t *testing.T) {
+	DB := testDB(t, (*model.ValidatorGroup)(nil))
+	var groups []*model.ValidatorGroup
+	for _, vg := range []*model.ValidatorGroup{
+		{Address: "0x1", Email: "ops@example.com", TwitterUsername: "one"},
+		{Address: "0x2", TwitterUsername: "two"},
+		{Address: "0x3", DiscordTag: "three#3"},
+	} {
+		if _, err := DB.Model(vg).Insert(); err != nil {
+			t.Fatal(err)
+		}
+		groups = append(groups, vg)
+	}
+
+	// The email moved from group 1 to group 3, and groups 1 and 2 swapped their Twitter usernames.
+	metadata := map[string]*AccountMetadata{
+		"0x1": {Address: "0x1", Twitter: "two"},
+		"0x2": {Address: "0x2", Twitter: "one"},
+		"0x3": {Address: "0x3", Email: "ops@example.com", Discord: "three#3"},
+	}
+	if err := releaseClaims(DB, groups, metadata); err != nil {
+		t.Fatalf("releaseClaims() error = %v", err)
+	}
+	for _, vg := range groups {
+		applyMetadata(vg, metadata[vg.Address])
+		if _, err := DB.Model(vg).WherePK().Update(); err != nil {
+			t.Fatalf("update of %s after releasing its claims: %v", vg.Address, err)
+		}
+	}
+
+	var stored []*model.ValidatorGroup
+	if err := DB.Model(&stored).Order("address").Select(); err != nil {
+		t.Fatal(err)
+	}
+	got := make([][3]string, len(stored))
+	for i, vg := range stored {
+		got[i] = [3]string{vg.Email, vg.TwitterUsername, vg.DiscordTag}
+	}
+	want := [][3]string{{"", "two", ""}, {"", "one", ""}, {"ops@example.com", "", "three#3"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("claims of the groups = %v, want %v", got, want)
+	}
+}
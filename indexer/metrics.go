@@ -0,0 +1,222 @@
+package indexer
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+//latencyBuckets are the upper bounds, in seconds, of the buckets of the upstream latency histogram.
+var latencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 90}
+
+//metrics is the state of the indexer exposed by MetricsHandler, updated as runs go.
+var metrics = newMetricsRegistry()
+
+type metricsRegistry struct {
+	mu sync.Mutex
+
+	lastIndexedEpoch uint64
+	chainEpoch       uint64
+
+	runs            map[string]uint64 // By result, "success" or "failure".
+	lastRunDuration time.Duration
+	lastSuccess     time.Time
+	groupsProcessed uint64
+	dbErrors        uint64
+	slowQueries     map[string]uint64 // By stage.
+
+	upstreams map[string]*upstreamMetrics // By endpoint name.
+}
+
+type upstreamMetrics struct {
+	requests     uint64
+	errors       uint64
+	circuitOpen  uint64
+	latencySum   float64
+	bucketCounts []uint64 // One per latencyBuckets, not cumulative.
+}
+
+func newMetricsRegistry() *metricsRegistry {
+	return &metricsRegistry{
+		runs:        make(map[string]uint64),
+		slowQueries: make(map[string]uint64),
+		upstreams:   make(map[string]*upstreamMetrics),
+	}
+}
+
+func (m *metricsRegistry) upstream(name string) *upstreamMetrics {
+	u, ok := m.upstreams[name]
+	if !ok {
+		u = &upstreamMetrics{bucketCounts: make([]uint64, len(latencyBuckets))}
+		m.upstreams[name] = u
+	}
+	return u
+}
+
+//observeRequest records a call to the upstream `endpoint` that took `latency`, and whether it failed.
+func (m *metricsRegistry) observeRequest(endpoint string, latency time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u := m.upstream(endpoint)
+	u.requests++
+	if err != nil {
+		u.errors++
+	}
+	seconds := latency.Seconds()
+	u.latencySum += seconds
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			u.bucketCounts[i]++
+			break
+		}
+	}
+}
+
+//observeCircuitOpen records a call to `endpoint` that wasn't made because its circuit breaker was open.
+func (m *metricsRegistry) observeCircuitOpen(endpoint string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.upstream(endpoint).circuitOpen++
+}
+
+//setLastIndexedEpoch records the last indexed epoch as read from the DB.
+func (m *metricsRegistry) setLastIndexedEpoch(epoch uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastIndexedEpoch = epoch
+}
+
+//observeIndexedEpoch records that `epoch` was committed. Reindexing an older epoch doesn't move the last indexed epoch back.
+func (m *metricsRegistry) observeIndexedEpoch(epoch uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if epoch > m.lastIndexedEpoch {
+		m.lastIndexedEpoch = epoch
+	}
+}
+
+func (m *metricsRegistry) setChainEpoch(epoch uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.chainEpoch = epoch
+}
+
+func (m *metricsRegistry) observeDBError() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dbErrors++
+}
+
+func (m *metricsRegistry) observeSlowQuery(stage string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.slowQueries[stage]++
+}
+
+//observeRun records a finished run of Index.
+func (m *metricsRegistry) observeRun(report *Report, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastRunDuration = report.FinishedAt.Sub(report.StartedAt)
+	m.groupsProcessed += uint64(report.GroupsProcessed)
+	if err != nil {
+		m.runs["failure"]++
+		return
+	}
+	m.runs["success"]++
+	m.lastSuccess = report.FinishedAt
+}
+
+//lastSuccessTime returns when the last successful run finished, zero if none has.
+func (m *metricsRegistry) lastSuccessTime() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lastSuccess
+}
+
+//MetricsHandler serves the indexer's metrics in the Prometheus text format.
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		metrics.write(w)
+	})
+}
+
+func (m *metricsRegistry) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lag := uint64(0)
+	if m.chainEpoch > m.lastIndexedEpoch {
+		lag = m.chainEpoch - m.lastIndexedEpoch
+	}
+	writeMetric(w, "celo_indexer_last_indexed_epoch", "gauge", "Last epoch stored in the DB.", m.lastIndexedEpoch)
+	writeMetric(w, "celo_indexer_chain_epoch", "gauge", "Epoch the chain is currently in.", m.chainEpoch)
+	writeMetric(w, "celo_indexer_epoch_lag", "gauge", "Number of epochs the DB is behind the chain.", lag)
+
+	writeHeader(w, "celo_indexer_runs_total", "counter", "Runs of the indexer, by result.")
+	for _, result := range []string{"success", "failure"} {
+		fmt.Fprintf(w, "celo_indexer_runs_total{result=%q} %d\n", result, m.runs[result])
+	}
+	writeMetric(w, "celo_indexer_last_run_duration_seconds", "gauge", "Duration of the last run.", m.lastRunDuration.Seconds())
+	lastSuccess := float64(0)
+	if !m.lastSuccess.IsZero() {
+		lastSuccess = float64(m.lastSuccess.Unix())
+	}
+	writeMetric(w, "celo_indexer_last_success_timestamp_seconds", "gauge", "Unix time the last successful run finished at.", lastSuccess)
+	writeMetric(w, "celo_indexer_groups_processed_total", "counter", "ValidatorGroups whose stats were written.", m.groupsProcessed)
+	writeMetric(w, "celo_indexer_db_errors_total", "counter", "Failed DB writes, and the reads they depend on.", m.dbErrors)
+
+	stages := make([]string, 0, len(m.slowQueries))
+	for stage := range m.slowQueries {
+		stages = append(stages, stage)
+	}
+	sort.Strings(stages)
+	writeHeader(w, "celo_indexer_slow_queries_total", "counter", "DB queries slower than the slow query threshold, by stage.")
+	for _, stage := range stages {
+		fmt.Fprintf(w, "celo_indexer_slow_queries_total{stage=%q} %d\n", stage, m.slowQueries[stage])
+	}
+
+	names := make([]string, 0, len(m.upstreams))
+	for name := range m.upstreams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	writeHeader(w, "celo_indexer_upstream_requests_total", "counter", "Requests to the upstream endpoints, retries included.")
+	for _, name := range names {
+		fmt.Fprintf(w, "celo_indexer_upstream_requests_total{endpoint=%q} %d\n", name, m.upstreams[name].requests)
+	}
+	writeHeader(w, "celo_indexer_upstream_errors_total", "counter", "Failed requests to the upstream endpoints.")
+	for _, name := range names {
+		fmt.Fprintf(w, "celo_indexer_upstream_errors_total{endpoint=%q} %d\n", name, m.upstreams[name].errors)
+	}
+	writeHeader(w, "celo_indexer_upstream_circuit_open_total", "counter", "Requests not made because the endpoint's circuit breaker was open.")
+	for _, name := range names {
+		fmt.Fprintf(w, "celo_indexer_upstream_circuit_open_total{endpoint=%q} %d\n", name, m.upstreams[name].circuitOpen)
+	}
+	writeHeader(w, "celo_indexer_upstream_latency_seconds", "histogram", "Latency of the requests to the upstream endpoints.")
+	for _, name := range names {
+		u := m.upstreams[name]
+		cumulative := uint64(0)
+		for i, bound := range latencyBuckets {
+			cumulative += u.bucketCounts[i]
+			fmt.Fprintf(w, "celo_indexer_upstream_latency_seconds_bucket{endpoint=%q,le=\"%g\"} %d\n", name, bound, cumulative)
+		}
+		fmt.Fprintf(w, "celo_indexer_upstream_latency_seconds_bucket{endpoint=%q,le=\"+Inf\"} %d\n", name, u.requests)
+		fmt.Fprintf(w, "celo_indexer_upstream_latency_seconds_sum{endpoint=%q} %g\n", name, u.latencySum)
+		fmt.Fprintf(w, "celo_indexer_upstream_latency_seconds_count{endpoint=%q} %d\n", name, u.requests)
+	}
+}
+
+func writeHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func writeMetric(w io.Writer, name, kind, help string, value interface{}) {
+	writeHeader(w, name, kind, help)
+	fmt.Fprintf(w, "%s %v\n", name, value)
+}
@@ -0,0 +1,61 @@
+package indexer
+
+import "time"
+
+//Election records that a Validator was elected in an epoch, as a member of a ValidatorGroup.
+//`EpochsServed` of a ValidatorGroup is derived from these rows.
+type Election struct {
+	ID               string    `pg:"default:gen_random_uuid()"`
+	EpochNumber      uint64    `pg:",notnull,unique:epoch_validator"`
+	ValidatorAddress string    `pg:",notnull,unique:epoch_validator"`
+	GroupAddress     string    `pg:",notnull"`
+	CreatedAt        time.Time `pg:"default:now()"`
+}
+
+//Membership records that a Validator was affiliated with a ValidatorGroup from JoinedEpoch until LeftEpoch.
+//The Membership is current while LeftEpoch is nil, and a Validator without a current Membership is inactive.
+type Membership struct {
+	ID               string    `pg:"default:gen_random_uuid()"`
+	ValidatorAddress string    `pg:",notnull"`
+	GroupAddress     string    `pg:",notnull"`
+	JoinedEpoch      uint64    `pg:",notnull"`
+	LeftEpoch        *uint64   // nil while the Validator is still a member.
+	CreatedAt        time.Time `pg:"default:now()"`
+}
+
+//ValidatorMove records that a Validator left one ValidatorGroup for another, as seen at Epoch.
+type ValidatorMove struct {
+	ID               string    `pg:"default:gen_random_uuid()"`
+	ValidatorAddress string    `pg:",notnull"`
+	FromGroupAddress string    // Empty if the previous ValidatorGroup isn't in the DB anymore.
+	ToGroupAddress   string    `pg:",notnull"`
+	Epoch            uint64    `pg:",notnull"`
+	CreatedAt        time.Time `pg:"default:now()"`
+}
+
+//AccountMetadata holds the claims of the metadata of an account whose signature was verified against its address.
+//Claims that aren't in the metadata are empty.
+type AccountMetadata struct {
+	ID           string `pg:"default:gen_random_uuid()"`
+	Address      string `pg:",notnull,unique"`
+	URL          string `pg:",notnull"`
+	Keybase      string
+	Twitter      string
+	Discord      string
+	Email        string
+	Location     string
+	LastVerified time.Time `pg:",notnull"` // When the signature of the claims was last checked.
+	CreatedAt    time.Time `pg:"default:now()"`
+}
+
+//PerformanceScore is the performance score of a ValidatorGroup in an epoch, as computed by the ScoringModel with ModelVersion.
+//Every configured model has a PerformanceScore, only the active one's is also the `PerformanceScore` of the ValidatorGroup.
+type PerformanceScore struct {
+	ID           string    `pg:"default:gen_random_uuid()"`
+	EpochNumber  uint64    `pg:",notnull,unique:epoch_group_model"`
+	GroupAddress string    `pg:",notnull,unique:epoch_group_model"`
+	ModelVersion string    `pg:",notnull,unique:epoch_group_model"`
+	Score        float64   `pg:",notnull,use_zero"`
+	Active       bool      `pg:",notnull,use_zero"` // Whether ModelVersion was the active model when the score was computed.
+	CreatedAt    time.Time `pg:"default:now()"`
+}
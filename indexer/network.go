@@ -0,0 +1,78 @@
+package indexer
+
+import (
+	"sort"
+	"time"
+)
+
+//Network is the profile of a Celo network: how its epochs are laid out, and where its data comes from.
+type Network struct {
+	Name string
+	// BlocksPerEpoch is the number of blocks in an epoch.
+	BlocksPerEpoch uint64
+	// BlockTime is the time between two blocks.
+	BlockTime time.Duration
+	// GenesisTime is the timestamp of the genesis block, used to align runs to epoch boundaries.
+	GenesisTime time.Time
+	// ExplorerURL is the URL of the network's explorer GraphQL API, used unless one is configured.
+	ExplorerURL string
+	// Schema is the Postgres schema the network's data is stored in, so that networks can share a DB.
+	Schema string
+}
+
+//Networks are the supported networks, by name.
+var Networks = map[string]Network{
+	"mainnet": {
+		Name:           "mainnet",
+		BlocksPerEpoch: 17280,
+		BlockTime:      5 * time.Second,
+		GenesisTime:    time.Date(2020, time.April, 22, 16, 0, 0, 0, time.UTC),
+		ExplorerURL:    "https://explorer.celo.org/graphiql",
+		// Mainnet keeps using the default schema, where it's been stored all along.
+		Schema: "public",
+	},
+	"alfajores": {
+		Name:           "alfajores",
+		BlocksPerEpoch: 17280,
+		BlockTime:      5 * time.Second,
+		GenesisTime:    time.Date(2020, time.June, 29, 16, 0, 0, 0, time.UTC),
+		ExplorerURL:    "https://alfajores-blockscout.celo-testnet.org/graphiql",
+		Schema:         "alfajores",
+	},
+	"baklava": {
+		Name:           "baklava",
+		BlocksPerEpoch: 17280,
+		BlockTime:      5 * time.Second,
+		GenesisTime:    time.Date(2020, time.July, 2, 16, 0, 0, 0, time.UTC),
+		ExplorerURL:    "https://baklava-blockscout.celo-testnet.org/graphiql",
+		Schema:         "baklava",
+	},
+}
+
+//Calendar returns the EpochCalendar of the network.
+func (n Network) Calendar() EpochCalendar {
+	return EpochCalendar{BlocksPerEpoch: n.BlocksPerEpoch}
+}
+
+//EpochDuration is the approximate wall-clock length of an epoch.
+func (n Network) EpochDuration() time.Duration {
+	return time.Duration(n.BlocksPerEpoch) * n.BlockTime
+}
+
+//EpochAt returns the epoch of the block produced at `t` according to the clock, 0 up to genesis.
+//It's an estimate, blocks aren't produced exactly every BlockTime.
+func (n Network) EpochAt(t time.Time) uint64 {
+	if !t.After(n.GenesisTime) {
+		return 0
+	}
+	return n.Calendar().EpochOfBlock(uint64(t.Sub(n.GenesisTime) / n.BlockTime))
+}
+
+func networkNames() []string {
+	names := make([]string, 0, len(Networks))
+	for name := range Networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
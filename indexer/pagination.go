@@ -0,0 +1,36 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+//connectionPageSize is the number of edges requested per page of a GraphQL connection.
+const connectionPageSize = 100
+
+//PageInfo is the pagination state of a page of a GraphQL connection.
+type PageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor"`
+}
+
+//paginate fetches the pages of a connection that come after `page`, until there are none left.
+//`fetchPage` fetches the page after the cursor `after`, keeps its edges and returns its PageInfo.
+func paginate(ctx context.Context, page PageInfo, fetchPage func(ctx context.Context, after string) (PageInfo, error)) error {
+	for page.HasNextPage {
+		if page.EndCursor == "" {
+			return errors.New("connection has a next page but no end cursor")
+		}
+		next, err := fetchPage(ctx, page.EndCursor)
+		if err != nil {
+			return fmt.Errorf("page after %s: %w", page.EndCursor, err)
+		}
+		// A cursor that doesn't move would have us fetch the same page forever.
+		if next.HasNextPage && next.EndCursor == page.EndCursor {
+			return fmt.Errorf("page after %s: end cursor didn't move", page.EndCursor)
+		}
+		page = next
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//connection serves `pages` in turn, the page after cursor "c<i>" being pages[i]. It records the cursors it's asked for.
+type connection struct {
+	pages   []PageInfo
+	fail    string
+	cursors []string
+}
+
+var errPage = errors.New("page unavailable")
+
+func (c *connection) fetchPage(ctx context.Context, after string) (PageInfo, error) {
+	c.cursors = append(c.cursors, after)
+	if after == c.fail {
+		return PageInfo{}, errPage
+	}
+	for i, page := range c.pages {
+		if after == fmt.Sprintf("c%d", i) {
+			return page, nil
+		}
+	}
+	return PageInfo{}, errors.New("unknown cursor " + after)
+}
+
+func TestPaginate(t *testing.T) {
+	tests := []struct {
+		name    string
+		first   PageInfo
+		pages   []PageInfo
+		fail    string
+		cursors []string
+		err     string
+	}{
+		{
+			name:  "single page",
+			first: PageInfo{HasNextPage: false, EndCursor: "c0"},
+		},
+		{
+			name:  "single page without cursor",
+			first: PageInfo{},
+		},
+		{
+			name:  "pages",
+			first: PageInfo{HasNextPage: true, EndCursor: "c0"},
+			pages: []PageInfo{
+				{HasNextPage: true, EndCursor: "c1"},
+				{HasNextPage: true, EndCursor: "c2"},
+				{HasNextPage: false, EndCursor: "c3"},
+			},
+			cursors: []string{"c0", "c1", "c2"},
+		},
+		{
+			name:  "last page without cursor",
+			first: PageInfo{HasNextPage: true, EndCursor: "c0"},
+			pages: []PageInfo{
+				{HasNextPage: false},
+			},
+			cursors: []string{"c0"},
+		},
+		{
+			name:  "missing cursor",
+			first: PageInfo{HasNextPage: true},
+			err:   "no end cursor",
+		},
+		{
+			name:  "missing cursor on a later page",
+			first: PageInfo{HasNextPage: true, EndCursor: "c0"},
+			pages: []PageInfo{
+				{HasNextPage: true},
+			},
+			cursors: []string{"c0"},
+			err:     "no end cursor",
+		},
+		{
+			name:  "cursor doesn't move",
+			first: PageInfo{HasNextPage: true, EndCursor: "c0"},
+			pages: []PageInfo{
+				{HasNextPage: true, EndCursor: "c1"},
+				{HasNextPage: true, EndCursor: "c1"},
+			},
+			cursors: []string{"c0", "c1"},
+			err:     "page after c1: end cursor didn't move",
+		},
+		{
+			name:  "failed page",
+			first: PageInfo{HasNextPage: true, EndCursor: "c0"},
+			pages: []PageInfo{
+				{HasNextPage: true, EndCursor: "c1"},
+			},
+			fail:    "c1",
+			cursors: []string{"c0", "c1"},
+			err:     "page after c1: page unavailable",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &connection{pages: tt.pages, fail: tt.fail}
+			err := paginate(context.Background(), tt.first, c.fetchPage)
+			if tt.err == "" && err != nil {
+				t.Errorf("paginate() error = %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("paginate() error = %v, want %q", err, tt.err)
+			}
+			if !reflect.DeepEqual(c.cursors, tt.cursors) {
+				t.Errorf("fetched the pages after %v, want %v", c.cursors, tt.cursors)
+			}
+		})
+	}
+}
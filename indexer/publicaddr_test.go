@@ -0,0 +1,80 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip     string
+		public bool
+	}{
+		{"1.1.1.1", true},
+		{"104.16.0.1", true},
+		{"2606:4700:4700::1111", true},
+		{"127.0.0.1", false},
+		{"127.1.2.3", false},
+		{"10.0.0.1", false},
+		{"172.16.0.1", false},
+		{"172.31.255.255", false},
+		{"172.32.0.1", true},
+		{"192.168.1.1", false},
+		{"100.64.0.1", false},
+		{"169.254.169.254", false},
+		{"0.0.0.0", false},
+		{"224.0.0.1", false},
+		{"255.255.255.255", false},
+		{"::1", false},
+		{"::", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+		{"ff02::1", false},
+	}
+	for _, tt := range tests {
+		if got := isPublicIP(net.ParseIP(tt.ip)); got != tt.public {
+			t.Errorf("isPublicIP(%s) = %v, want %v", tt.ip, got, tt.public)
+		}
+	}
+}
+
+func TestPublicTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	client := &http.Client{Transport: publicTransport()}
+
+	for _, url := range []string{server.URL, fmt.Sprintf("http://localhost:%d", server.Listener.Addr().(*net.TCPAddr).Port)} {
+		resp, err := httpGet(context.Background(), client, url)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if !errors.Is(err, ErrNonPublicAddress) {
+			t.Errorf("GET %s error = %v, want %v", url, err, ErrNonPublicAddress)
+		}
+		if isRetryable(err) {
+			t.Errorf("GET %s error is retried", url)
+		}
+	}
+}
+
+func TestAccountMetadataNonPublic(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("metadata fetched from a loopback address")
+	}))
+	defer server.Close()
+
+	src, err := NewExplorerSource(validConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.AccountMetadata(context.Background(), server.URL); !errors.Is(err, ErrNonPublicAddress) {
+		t.Errorf("AccountMetadata() error = %v, want %v", err, ErrNonPublicAddress)
+	}
+}
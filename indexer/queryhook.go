@@ -0,0 +1,48 @@
+package indexer
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+//maxLoggedQueryLength truncates the queries logged by SlowQueryHook, bulk inserts can be huge.
+const maxLoggedQueryLength = 2000
+
+//SlowQueryHook is a pg.QueryHook that logs the queries taking at least Threshold, with their duration
+//and the stage of the run that issued them, and counts them in the metrics by stage.
+type SlowQueryHook struct {
+	Threshold time.Duration
+}
+
+var _ pg.QueryHook = SlowQueryHook{}
+
+//BeforeQuery does nothing, go-pg already records when the query started.
+func (h SlowQueryHook) BeforeQuery(ctx context.Context, evt *pg.QueryEvent) (context.Context, error) {
+	return ctx, nil
+}
+
+//AfterQuery logs the query if it took at least Threshold.
+func (h SlowQueryHook) AfterQuery(ctx context.Context, evt *pg.QueryEvent) error {
+	duration := time.Since(evt.StartTime)
+	if duration < h.Threshold {
+		return nil
+	}
+
+	stage := stageOf(ctx)
+	if stage == "" {
+		stage = "none"
+	}
+	metrics.observeSlowQuery(stage)
+
+	query, err := evt.FormattedQuery()
+	if err != nil {
+		query = []byte(err.Error())
+	}
+	if len(query) > maxLoggedQueryLength {
+		query = append(query[:maxLoggedQueryLength:maxLoggedQueryLength], "..."...)
+	}
+	Log(ctx).Warn("Slow query", "duration", duration, "query", string(query))
+	return nil
+}
@@ -0,0 +1,62 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketBurst(t *testing.T) {
+	b := newTokenBucket(20, 3)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := b.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 25*time.Millisecond {
+		t.Errorf("burst of 3 took %s, want no wait", elapsed)
+	}
+
+	// The bucket is empty, the next token is refilled after 1/20s.
+	start = time.Now()
+	if err := b.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("token after the burst took %s, want about 50ms", elapsed)
+	}
+}
+
+func TestTokenBucketUnlimited(t *testing.T) {
+	b := newTokenBucket(0, 1)
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		if err := b.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 25*time.Millisecond {
+		t.Errorf("100 tokens without a rate took %s, want no wait", elapsed)
+	}
+}
+
+func TestTokenBucketCanceled(t *testing.T) {
+	b := newTokenBucket(0.1, 1)
+	if err := b.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := b.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := newTokenBucket(0, 1).Wait(canceled); !errors.Is(err, context.Canceled) {
+		t.Errorf("Wait() without a rate error = %v, want %v", err, context.Canceled)
+	}
+}
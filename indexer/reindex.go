@@ -0,0 +1,60 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+//Reindex recomputes the Epochs from `from` to `to` (inclusive), along with their Elections and `EpochsServed`,
+//without touching the rest of the DB. Use it to repair bad data without re-indexing from epoch 1.
+//It fails with ErrRunInProgress while the indexer is running against the same DB, and the other way around.
+//
+//Epochs are fetched concurrently as in a backfill, and each one is replaced in its own transaction.
+//Epoch rows are updated in place rather than deleted, so that the stats pointing at them are kept.
+//Only Epochs that were already indexed can be reindexed: a range past the last indexed Epoch would move
+//the point `findLastIndexedEpoch` resumes from, and leave a gap that's never filled.
+func Reindex(ctx context.Context, DB *pg.DB, src ChainSource, from, to uint64, cfg *Config) (*Report, error) {
+	report := newReport()
+	ctx = withLogField(ctx, LogRunID, report.RunID)
+	defer func() { report.FinishedAt = time.Now() }()
+
+	if from < 1 || from > to {
+		return report, fmt.Errorf("reindex: invalid epoch range %d-%d", from, to)
+	}
+
+	unlock, err := lockRun(ctx, DB)
+	if err != nil {
+		return report, err
+	}
+	defer unlock()
+
+	currentEpoch, err := src.CurrentEpoch(ctx)
+	if err != nil {
+		return report, fetchError("current epoch", err)
+	}
+	report.CurrentEpoch = currentEpoch
+	if to > currentEpoch {
+		return report, fmt.Errorf("reindex: epoch %d is after the current epoch %d", to, currentEpoch)
+	}
+
+	lastIndexedEpoch, err := findLastIndexedEpoch(DB.WithContext(ctx))
+	if err != nil {
+		if err.Error() == NoResultError {
+			return report, fmt.Errorf("reindex: no epoch indexed yet, run the indexer first")
+		}
+		return report, persistError("find last indexed epoch", err)
+	}
+	if to > lastIndexedEpoch.Number {
+		return report, fmt.Errorf("reindex: epoch %d is after the last indexed epoch %d", to, lastIndexedEpoch.Number)
+	}
+
+	Log(ctx).Info("Reindexing epochs", "from", from, "to", to)
+	if err := backfillEpochs(withStage(ctx, "reindex"), DB, src, from, to, cfg, report); err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
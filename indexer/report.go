@@ -0,0 +1,67 @@
+package indexer
+
+import (
+	"context"
+	"time"
+)
+
+// Kinds of entities a Failure can be about.
+const (
+	FailureGroup     = "group"
+	FailureValidator = "validator"
+)
+
+//Report summarises a run of Index.
+type Report struct {
+	// RunID tags the log lines of the run.
+	RunID         string
+	StartedAt     time.Time
+	FinishedAt    time.Time
+	CurrentEpoch  uint64
+	EpochsIndexed []uint64
+	// GroupsProcessed is the number of ValidatorGroups whose stats were written for the current epoch.
+	GroupsProcessed int
+	Failures        []Failure
+}
+
+//Failure is a ValidatorGroup or Validator that couldn't be indexed during a run.
+//The rest of the run carries on without it.
+type Failure struct {
+	Kind    string // FailureGroup or FailureValidator.
+	Address string
+	Err     error
+}
+
+func newReport() *Report {
+	return &Report{RunID: newRunID(), StartedAt: time.Now()}
+}
+
+//addFailure adds a Failure to the report, and logs it with the fields of ctx.
+func (r *Report) addFailure(ctx context.Context, kind, address string, err error) {
+	key := LogGroup
+	if kind == FailureValidator {
+		key = "validator"
+	}
+	Log(ctx).Warn("Skipped "+kind, key, address, "error", err)
+	r.Failures = append(r.Failures, Failure{Kind: kind, Address: address, Err: err})
+}
+
+//FailedGroups returns the failures of ValidatorGroups.
+func (r *Report) FailedGroups() []Failure {
+	return r.failuresOfKind(FailureGroup)
+}
+
+//FailedValidators returns the failures of Validators.
+func (r *Report) FailedValidators() []Failure {
+	return r.failuresOfKind(FailureValidator)
+}
+
+func (r *Report) failuresOfKind(kind string) []Failure {
+	var failures []Failure
+	for _, f := range r.Failures {
+		if f.Kind == kind {
+			failures = append(failures, f)
+		}
+	}
+	return failures
+}
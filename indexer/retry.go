@@ -0,0 +1,235 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+//ErrCircuitOpen is returned instead of calling an endpoint whose circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+//StatusError is an HTTP response with an unsuccessful status code.
+type StatusError struct {
+	Code int
+	URL  string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: unexpected status %d %s", e.URL, e.Code, http.StatusText(e.Code))
+}
+
+//RetryPolicy configures how calls to an endpoint are retried, and when its circuit breaker opens.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a call is made before giving up, including the first one.
+	MaxAttempts int `json:"maxAttempts"`
+	// BaseDelay is the delay before the first retry, doubled for each retry after it, up to MaxDelay.
+	BaseDelay time.Duration `json:"baseDelay"`
+	MaxDelay  time.Duration `json:"maxDelay"`
+	// BreakerThreshold is the number of failures in a row after which calls to the endpoint stop for BreakerCooldown.
+	BreakerThreshold int           `json:"breakerThreshold"`
+	BreakerCooldown  time.Duration `json:"breakerCooldown"`
+}
+
+//RetryConfig holds the RetryPolicy of every endpoint, by name. Endpoints without a policy use Default.
+type RetryConfig struct {
+	Default   RetryPolicy            `json:"default"`
+	Endpoints map[string]RetryPolicy `json:"endpoints"`
+}
+
+//DefaultRetryConfig returns the RetryConfig used when none is configured.
+func DefaultRetryConfig() RetryConfig {
+	return RetryConfig{
+		Default: RetryPolicy{
+			MaxAttempts:      4,
+			BaseDelay:        time.Second,
+			MaxDelay:         30 * time.Second,
+			BreakerThreshold: 8,
+			BreakerCooldown:  time.Minute,
+		},
+	}
+}
+
+func (c RetryConfig) problems() []string {
+	problems := c.Default.problems("default")
+	names := make([]string, 0, len(c.Endpoints))
+	for name := range c.Endpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		problems = append(problems, c.Endpoints[name].problems(fmt.Sprintf("endpoint %q", name))...)
+	}
+	return problems
+}
+
+func (p RetryPolicy) problems(name string) []string {
+	var problems []string
+	if p.MaxAttempts < 1 {
+		problems = append(problems, fmt.Sprintf("%s retry policy needs at least 1 attempt", name))
+	}
+	if p.BaseDelay <= 0 {
+		problems = append(problems, fmt.Sprintf("%s retry policy needs a positive base delay", name))
+	}
+	if p.MaxDelay < p.BaseDelay {
+		problems = append(problems, fmt.Sprintf("%s retry policy has a max delay (%s) shorter than its base delay (%s)", name, p.MaxDelay, p.BaseDelay))
+	}
+	if p.BreakerThreshold < 0 {
+		problems = append(problems, fmt.Sprintf("%s retry policy has a negative breaker threshold", name))
+	}
+	if p.BreakerThreshold > 0 && p.BreakerCooldown <= 0 {
+		problems = append(problems, fmt.Sprintf("%s retry policy needs a positive breaker cooldown", name))
+	}
+	return problems
+}
+
+func (c RetryConfig) policy(endpoint string) RetryPolicy {
+	if p, ok := c.Endpoints[endpoint]; ok {
+		return p
+	}
+	return c.Default
+}
+
+//endpoint retries the calls to a single upstream endpoint, and stops calling it while its circuit breaker is open.
+type endpoint struct {
+	name   string
+	policy RetryPolicy
+
+	mu        sync.Mutex
+	failures  int       // Retryable failures in a row.
+	openUntil time.Time // The breaker is open until then.
+}
+
+func newEndpoint(name string, policy RetryPolicy) *endpoint {
+	return &endpoint{name: name, policy: policy}
+}
+
+//do calls `call` until it succeeds, fails with an error that isn't worth retrying, or runs out of attempts.
+func (e *endpoint) do(ctx context.Context, call func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		if err := e.allow(); err != nil {
+			metrics.observeCircuitOpen(e.name)
+			return err
+		}
+
+		start := time.Now()
+		err := call(ctx)
+		metrics.observeRequest(e.name, time.Since(start), err)
+		if err == nil {
+			e.succeeded()
+			return nil
+		}
+		if ctx.Err() != nil || !isRetryable(err) {
+			return err
+		}
+		e.failed()
+
+		if attempt >= e.policy.MaxAttempts {
+			return fmt.Errorf("%s: giving up after %d attempts: %w", e.name, attempt, err)
+		}
+
+		delay := e.backoff(attempt)
+		Log(ctx).Warn("Retrying upstream request", "endpoint", e.name, "attempt", attempt, "delay", delay, "error", err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+func (e *endpoint) allow() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if time.Now().Before(e.openUntil) {
+		return fmt.Errorf("%s: %w until %s", e.name, ErrCircuitOpen, e.openUntil.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func (e *endpoint) succeeded() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.failures = 0
+}
+
+func (e *endpoint) failed() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.failures++
+	if e.policy.BreakerThreshold > 0 && e.failures >= e.policy.BreakerThreshold {
+		e.openUntil = time.Now().Add(e.policy.BreakerCooldown)
+		e.failures = 0
+	}
+}
+
+//backoff returns the delay before retrying after `attempt`: exponential, capped at MaxDelay,
+//with jitter so that concurrent callers don't retry in lockstep.
+func (e *endpoint) backoff(attempt int) time.Duration {
+	delay := e.policy.BaseDelay << uint(attempt-1)
+	if delay <= 0 || (e.policy.MaxDelay > 0 && delay > e.policy.MaxDelay) {
+		delay = e.policy.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := int64(delay / 2)
+	return time.Duration(half + jitter(half+1))
+}
+
+var (
+	jitterMu  sync.Mutex
+	jitterRnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+func jitter(n int64) int64 {
+	jitterMu.Lock()
+	defer jitterMu.Unlock()
+	return jitterRnd.Int63n(n)
+}
+
+//isRetryable reports whether `err` is likely transient: a 5xx or 429 response, a timeout or a failed connection.
+func isRetryable(err error) bool {
+	if errors.Is(err, ErrNonPublicAddress) {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code >= 500 || statusErr.Code == http.StatusTooManyRequests
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr)
+}
+
+//statusTransport turns 5xx and 429 responses into a *StatusError, so they can be retried
+//even by clients that don't look at the status code.
+type statusTransport struct {
+	base http.RoundTripper
+}
+
+func (t statusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		resp.Body.Close()
+		return nil, &StatusError{Code: resp.StatusCode, URL: req.URL.String()}
+	}
+	return resp, nil
+}
@@ -0,0 +1,209 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+//timeoutError is a net.Error that timed out, as returned by an http.Client whose Timeout is exceeded.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"500", &StatusError{Code: http.StatusInternalServerError}, true},
+		{"502", &StatusError{Code: http.StatusBadGateway}, true},
+		{"503 wrapped", fmt.Errorf("current epoch: %w", &StatusError{Code: http.StatusServiceUnavailable}), true},
+		{"429", &StatusError{Code: http.StatusTooManyRequests}, true},
+		{"400", &StatusError{Code: http.StatusBadRequest}, false},
+		{"404", &StatusError{Code: http.StatusNotFound}, false},
+		{"deadline exceeded", context.DeadlineExceeded, true},
+		{"net timeout", fmt.Errorf("get: %w", timeoutError{}), true},
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, true},
+		{"canceled", context.Canceled, false},
+		{"circuit open", fmt.Errorf("explorer: %w", ErrCircuitOpen), false},
+		{"malformed response", fmt.Errorf("target-apy: %w", ErrMalformedResponse), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryable(tt.err); got != tt.want {
+				t.Errorf("isRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+//testPolicy retries without delay, and doesn't open the breaker unless `threshold` is set.
+func testPolicy(attempts, threshold int) RetryPolicy {
+	return RetryPolicy{MaxAttempts: attempts, BreakerThreshold: threshold, BreakerCooldown: time.Hour}
+}
+
+//failingCall fails with `errs` in turn, then succeeds, counting the calls in `calls`.
+func failingCall(calls *int, errs ...error) func(context.Context) error {
+	return func(context.Context) error {
+		*calls++
+		if *calls <= len(errs) {
+			return errs[*calls-1]
+		}
+		return nil
+	}
+}
+
+func TestEndpointDo(t *testing.T) {
+	unavailable := &StatusError{Code: http.StatusServiceUnavailable}
+	notFound := &StatusError{Code: http.StatusNotFound}
+	tests := []struct {
+		name     string
+		attempts int
+		errs     []error
+		calls    int
+		err      error
+	}{
+		{"success", 3, nil, 1, nil},
+		{"retried", 3, []error{unavailable, unavailable}, 3, nil},
+		{"gives up", 3, []error{unavailable, unavailable, unavailable}, 3, unavailable},
+		{"not retryable", 3, []error{notFound}, 1, notFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := newEndpoint("test", testPolicy(tt.attempts, 0)).do(context.Background(), failingCall(&calls, tt.errs...))
+			if !errors.Is(err, tt.err) {
+				t.Errorf("do() error = %v, want %v", err, tt.err)
+			}
+			if calls != tt.calls {
+				t.Errorf("call made %d times, want %d", calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestEndpointBreaker(t *testing.T) {
+	unavailable := &StatusError{Code: http.StatusServiceUnavailable}
+	e := newEndpoint("test", testPolicy(1, 3))
+
+	// Failures that aren't retryable don't count towards the breaker.
+	calls := 0
+	e.do(context.Background(), failingCall(&calls, &StatusError{Code: http.StatusNotFound}))
+
+	for i := 0; i < 3; i++ {
+		calls = 0
+		if err := e.do(context.Background(), failingCall(&calls, unavailable)); errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("breaker open after %d failures, want 3", i)
+		}
+	}
+
+	calls = 0
+	err := e.do(context.Background(), failingCall(&calls))
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("do() error = %v, want %v", err, ErrCircuitOpen)
+	}
+	if calls != 0 {
+		t.Errorf("call made %d times while the breaker is open, want 0", calls)
+	}
+
+	// Once the cooldown is over, calls go through again.
+	e.mu.Lock()
+	e.openUntil = time.Now().Add(-time.Second)
+	e.mu.Unlock()
+	if err := e.do(context.Background(), failingCall(&calls)); err != nil {
+		t.Errorf("do() after the cooldown error = %v", err)
+	}
+}
+
+func TestEndpointBreakerResetBySuccess(t *testing.T) {
+	unavailable := &StatusError{Code: http.StatusServiceUnavailable}
+	e := newEndpoint("test", testPolicy(1, 3))
+
+	for i := 0; i < 4; i++ {
+		// Two failures, then a success, never reach the threshold.
+		calls := 0
+		e.do(context.Background(), failingCall(&calls, unavailable))
+		calls = 0
+		e.do(context.Background(), failingCall(&calls, unavailable))
+		calls = 0
+		if err := e.do(context.Background(), failingCall(&calls)); err != nil {
+			t.Fatalf("do() error = %v", err)
+		}
+	}
+}
+
+func TestEndpointRetriesWithinPolicy(t *testing.T) {
+	unavailable := &StatusError{Code: http.StatusServiceUnavailable}
+	// A single call retried up to the threshold opens the breaker for the calls after it.
+	e := newEndpoint("test", testPolicy(4, 2))
+	calls := 0
+	err := e.do(context.Background(), failingCall(&calls, unavailable, unavailable, unavailable))
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("do() error = %v, want %v", err, ErrCircuitOpen)
+	}
+	if calls != 2 {
+		t.Errorf("call made %d times, want 2", calls)
+	}
+}
+
+func TestEndpointBackoff(t *testing.T) {
+	e := newEndpoint("test", RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second})
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{40, time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			if got := e.backoff(tt.attempt); got < tt.max/2 || got > tt.max {
+				t.Errorf("backoff(%d) = %s, want between %s and %s", tt.attempt, got, tt.max/2, tt.max)
+			}
+		}
+	}
+}
+
+func TestStatusTransport(t *testing.T) {
+	tests := []struct {
+		code int
+		err  bool
+	}{
+		{http.StatusOK, false},
+		{http.StatusNotFound, false},
+		{http.StatusTooManyRequests, true},
+		{http.StatusBadGateway, true},
+	}
+	for _, tt := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.code)
+		}))
+		client := &http.Client{Transport: statusTransport{base: http.DefaultTransport}}
+		resp, err := client.Get(server.URL)
+		var statusErr *StatusError
+		if tt.err && (!errors.As(err, &statusErr) || statusErr.Code != tt.code) {
+			t.Errorf("status %d: error = %v, want a *StatusError", tt.code, err)
+		}
+		if !tt.err {
+			if err != nil {
+				t.Errorf("status %d: error = %v", tt.code, err)
+			} else {
+				resp.Body.Close()
+			}
+		}
+		server.Close()
+	}
+}
@@ -0,0 +1,100 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+//Scheduler runs Index on a fixed interval, aligned to epoch boundaries, until its context is cancelled.
+type Scheduler struct {
+	DB       *pg.DB
+	Source   ChainSource
+	Config   *Config
+	Network  Network
+	Interval time.Duration
+	// RetryDelay is how long to wait before retrying a run that returned an error, instead of waiting for the next tick.
+	RetryDelay time.Duration
+
+	running int32 // Set while a run is in progress, guards against overlapping runs in this process, see lockRun for the others.
+}
+
+//NewScheduler returns a Scheduler that indexes every `cfg.Interval`.
+//The interval has to evenly divide an epoch so that one of the runs always falls on an epoch boundary.
+func NewScheduler(DB *pg.DB, src ChainSource, cfg *Config) (*Scheduler, error) {
+	interval := cfg.Interval
+	network, ok := cfg.NetworkProfile()
+	if !ok {
+		return nil, fmt.Errorf("scheduler: unknown network %q", cfg.Network)
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("scheduler: interval must be positive, got %s", interval)
+	}
+	if network.EpochDuration()%interval != 0 {
+		return nil, fmt.Errorf("scheduler: interval %s does not evenly divide an epoch (%s)", interval, network.EpochDuration())
+	}
+	return &Scheduler{DB: DB, Source: src, Config: cfg, Network: network, Interval: interval, RetryDelay: cfg.RetryDelay}, nil
+}
+
+//Run indexes once immediately and then at every aligned tick, until ctx is cancelled.
+//A run in progress when ctx is cancelled is allowed to wind down before Run returns.
+func (s *Scheduler) Run(ctx context.Context) error {
+	for {
+		err := s.runOnce(ctx)
+
+		next := nextRun(time.Now(), s.Network.GenesisTime, s.Interval)
+		if err != nil && s.RetryDelay > 0 {
+			if retryAt := time.Now().Add(s.RetryDelay); retryAt.Before(next) {
+				next = retryAt
+			}
+		}
+		Log(ctx).Info("Scheduled next run", "at", next.Format(time.RFC3339))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			Log(ctx).Info("Scheduler stopped")
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+//runOnce runs Index, unless another run is still in progress, and logs its report.
+func (s *Scheduler) runOnce(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&s.running, 0, 1) {
+		Log(ctx).Warn("Previous run still in progress, skipping")
+		return nil
+	}
+	defer atomic.StoreInt32(&s.running, 0)
+
+	report, err := Index(ctx, s.DB, s.Source, s.Config)
+	LogReport(ctx, report, err)
+	return err
+}
+
+//LogReport logs the outcome of a run of Index. The failures were already logged as they happened.
+func LogReport(ctx context.Context, report *Report, err error) {
+	l := Log(ctx).With(LogRunID, report.RunID).
+		With("duration", report.FinishedAt.Sub(report.StartedAt)).
+		With("epochs_indexed", len(report.EpochsIndexed)).
+		With("groups_processed", report.GroupsProcessed).
+		With("failures", len(report.Failures))
+	if err != nil {
+		l.Error("Run failed", "error", err)
+		return
+	}
+	l.Info("Run finished")
+}
+
+//nextRun returns the first tick after `now`, counting ticks of `interval` from the genesis block.
+//Ticks that were missed because a run took longer than `interval` are skipped.
+func nextRun(now, genesis time.Time, interval time.Duration) time.Time {
+	elapsed := now.Sub(genesis)
+	ticks := elapsed/interval + 1
+	return genesis.Add(ticks * interval)
+}
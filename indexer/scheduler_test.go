@@ -0,0 +1,50 @@
+package indexer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextRun(t *testing.T) {
+	genesis := Networks["mainnet"].GenesisTime
+	epoch := Networks["mainnet"].EpochDuration()
+	boundary := genesis.Add(100 * epoch)
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		interval time.Duration
+		want     time.Time
+	}{
+		{"on the boundary", boundary, time.Hour, boundary.Add(time.Hour)},
+		{"just before the boundary", boundary.Add(-time.Nanosecond), time.Hour, boundary},
+		{"a second before the boundary", boundary.Add(-time.Second), time.Hour, boundary},
+		{"just after the boundary", boundary.Add(time.Nanosecond), time.Hour, boundary.Add(time.Hour)},
+		{"mid interval", boundary.Add(90 * time.Minute), time.Hour, boundary.Add(2 * time.Hour)},
+		{"interval of an epoch", boundary.Add(-time.Minute), epoch, boundary},
+		{"interval of an epoch, on the boundary", boundary, epoch, boundary.Add(epoch)},
+		// Ticks are counted from genesis, every other boundary is skipped.
+		{"interval of two epochs", boundary.Add(time.Minute), 2 * epoch, boundary.Add(2 * epoch)},
+		{"interval of two epochs, odd boundary", boundary.Add(epoch - time.Minute), 2 * epoch, boundary.Add(2 * epoch)},
+		{"at genesis", genesis, time.Hour, genesis.Add(time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nextRun(tt.now, genesis, tt.interval); !got.Equal(tt.want) {
+				t.Errorf("nextRun(%s, %s) = %s, want %s", tt.now, tt.interval, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextRunAlignedToEpochs(t *testing.T) {
+	network := Networks["mainnet"]
+	// Every interval accepted by Validate has a tick on each epoch boundary.
+	for _, interval := range []time.Duration{time.Hour, 30 * time.Minute, 8 * time.Hour, network.EpochDuration()} {
+		boundary := network.GenesisTime.Add(42 * network.EpochDuration())
+		now := boundary.Add(-interval / 2)
+		if got := nextRun(now, network.GenesisTime, interval); !got.Equal(boundary) {
+			t.Errorf("interval %s: nextRun() = %s, want the epoch boundary %s", interval, got, boundary)
+		}
+	}
+}
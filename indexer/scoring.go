@@ -0,0 +1,175 @@
+package indexer
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/buidl-labs/celo-voting-validator-backend/graph/model"
+)
+
+//weightsTolerance is how far from 1 the weights of a ScoringModel can sum, to allow for decimal weights.
+const weightsTolerance = 1e-9
+
+//ScoringModel is a versioned formula of the performance score of a ValidatorGroup: the weighted sum of its stats.
+type ScoringModel struct {
+	// Version identifies the model, and is stored with each PerformanceScore it computed.
+	Version string         `json:"version"`
+	Weights ScoringWeights `json:"weights"`
+	// ElectedCountScale is the number of elected Validators that earns the whole ElectedCount weight.
+	// Each elected Validator adds ElectedCount/ElectedCountScale, past the scale too.
+	ElectedCountScale float64 `json:"electedCountScale"`
+}
+
+//ScoringWeights are the weights of the stats of a ValidatorGroup in a ScoringModel. They have to sum to 1.
+type ScoringWeights struct {
+	// Slashing weighs the slashing multiplier.
+	Slashing float64 `json:"slashing"`
+	// GroupScore weighs the average score of the elected Validators.
+	GroupScore float64 `json:"groupScore"`
+	// EpochsServedHistory weighs the share of all the epochs the VG had a Validator elected in.
+	EpochsServedHistory float64 `json:"epochsServedHistory"`
+	// EpochsServedCapacity weighs the share of the epochs since the VG registered it had a Validator elected in.
+	EpochsServedCapacity float64 `json:"epochsServedCapacity"`
+	// LockedCelo weighs the locked CELO per Validator, relative to the highest one.
+	LockedCelo float64 `json:"lockedCelo"`
+	// Attestation weighs the average share of attestations fulfilled by the Validators.
+	Attestation float64 `json:"attestation"`
+	// ElectedRatio weighs the share of the Validators that are elected.
+	ElectedRatio float64 `json:"electedRatio"`
+	// ElectedCount weighs the number of elected Validators, see ElectedCountScale.
+	ElectedCount float64 `json:"electedCount"`
+}
+
+func (w ScoringWeights) all() []float64 {
+	return []float64{w.Slashing, w.GroupScore, w.EpochsServedHistory, w.EpochsServedCapacity, w.LockedCelo, w.Attestation, w.ElectedRatio, w.ElectedCount}
+}
+
+//ScoringConfig lists the ScoringModels to compute, and the Active one.
+type ScoringConfig struct {
+	// Active is the Version of the model whose score is written to the ValidatorGroups.
+	Active string `json:"active"`
+	// Models are all computed and stored as PerformanceScores, so that a new model can be compared
+	// with the active one before it's rolled out.
+	Models []ScoringModel `json:"models"`
+}
+
+//DefaultScoringConfig returns the ScoringConfig used when none is configured, with only the "v1" model.
+func DefaultScoringConfig() ScoringConfig {
+	return ScoringConfig{
+		Active: "v1",
+		Models: []ScoringModel{{
+			Version: "v1",
+			Weights: ScoringWeights{
+				Slashing:             0.3,
+				GroupScore:           0.3,
+				EpochsServedHistory:  0.1,
+				EpochsServedCapacity: 0.1,
+				LockedCelo:           0.06,
+				Attestation:          0.06,
+				ElectedRatio:         0.06,
+				ElectedCount:         0.02,
+			},
+			ElectedCountScale: 5,
+		}},
+	}
+}
+
+//UnmarshalJSON decodes a ScoringConfig. Models replace the default ones instead of being merged into them.
+func (c *ScoringConfig) UnmarshalJSON(b []byte) error {
+	type scoringConfig ScoringConfig
+	aux := &struct {
+		*scoringConfig
+		Models []ScoringModel `json:"models"`
+	}{
+		scoringConfig: (*scoringConfig)(c),
+	}
+	if err := decodeStrict(b, aux); err != nil {
+		return err
+	}
+	if aux.Models != nil {
+		c.Models = aux.Models
+	}
+	return nil
+}
+
+//active returns the Active model, and whether it's one of Models.
+func (c ScoringConfig) active() (ScoringModel, bool) {
+	for _, m := range c.Models {
+		if m.Version == c.Active {
+			return m, true
+		}
+	}
+	return ScoringModel{}, false
+}
+
+func (c ScoringConfig) problems() []string {
+	var problems []string
+	versions := make(map[string]bool, len(c.Models))
+	for _, m := range c.Models {
+		if m.Version == "" {
+			problems = append(problems, "scoring model without a version")
+			continue
+		}
+		if versions[m.Version] {
+			problems = append(problems, fmt.Sprintf("scoring model %q defined more than once", m.Version))
+		}
+		versions[m.Version] = true
+
+		sum := float64(0)
+		for _, w := range m.Weights.all() {
+			if w < 0 {
+				problems = append(problems, fmt.Sprintf("scoring model %q has a negative weight", m.Version))
+			}
+			sum += w
+		}
+		if math.Abs(sum-1) > weightsTolerance {
+			problems = append(problems, fmt.Sprintf("weights of scoring model %q sum to %g instead of 1", m.Version, sum))
+		}
+		if m.Weights.ElectedCount > 0 && m.ElectedCountScale <= 0 {
+			problems = append(problems, fmt.Sprintf("scoring model %q needs a positive elected count scale", m.Version))
+		}
+	}
+	if _, ok := c.active(); !ok {
+		problems = append(problems, fmt.Sprintf("active scoring model %q isn't defined", c.Active))
+	}
+	return problems
+}
+
+//score returns the performance score of `vg` after `totalEpochs` epochs.
+func (m ScoringModel) score(vg *model.ValidatorGroup, totalEpochs float64) float64 {
+	w := m.Weights
+	performanceScore := float64(0)
+	performanceScore += vg.SlashingPenaltyScore * w.Slashing
+	performanceScore += vg.GroupScore * w.GroupScore
+
+	epochsServedHistoryPercent := float64(vg.EpochsServed) / totalEpochs
+	epochsAvailable := totalEpochs - float64(vg.EpochRegisteredAt)
+	var epochsServedHistoryCapacity float64
+	if epochsAvailable == 0 {
+		epochsServedHistoryCapacity = 0.0
+	} else {
+		epochsServedHistoryCapacity = math.Min((float64(vg.EpochsServed) / epochsAvailable), float64(1))
+	}
+
+	performanceScore += epochsServedHistoryPercent * w.EpochsServedHistory
+	performanceScore += epochsServedHistoryCapacity * w.EpochsServedCapacity
+
+	performanceScore += vg.LockedCeloPercentile * w.LockedCelo
+	performanceScore += vg.AttestationScore * w.Attestation
+	numElectedValidators := 0
+	totalValidators := 0
+	for _, v := range vg.Validators {
+		if v.CurrentlyElected {
+			numElectedValidators++
+		}
+		totalValidators++
+	}
+	if totalValidators > 0 {
+		performanceScore += (float64(numElectedValidators) / float64(totalValidators)) * w.ElectedRatio
+	}
+	if m.ElectedCountScale > 0 {
+		performanceScore += float64(numElectedValidators) * w.ElectedCount / m.ElectedCountScale
+	}
+
+	return performanceScore
+}
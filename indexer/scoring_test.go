@@ -0,0 +1,172 @@
+package indexer
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/buidl-labs/celo-voting-validator-backend/graph/model"
+)
+
+//legacyPerformanceScore is the formula used before ScoringModels, which "v1" has to reproduce.
+func legacyPerformanceScore(vg *model.ValidatorGroup, totalEpochs float64) float64 {
+	performanceScore := vg.SlashingPenaltyScore*0.3 + vg.GroupScore*0.3
+
+	epochsServedHistoryPercent := float64(vg.EpochsServed) / totalEpochs
+	epochsAvailable := totalEpochs - float64(vg.EpochRegisteredAt)
+	var epochsServedHistoryCapacity float64
+	if epochsAvailable != 0 {
+		epochsServedHistoryCapacity = math.Min(float64(vg.EpochsServed)/epochsAvailable, 1)
+	}
+	performanceScore += epochsServedHistoryPercent*0.1 + epochsServedHistoryCapacity*0.1
+	performanceScore += vg.LockedCeloPercentile*0.06 + vg.AttestationScore*0.06
+
+	elected := 0
+	for _, v := range vg.Validators {
+		if v.CurrentlyElected {
+			elected++
+		}
+	}
+	if len(vg.Validators) > 0 {
+		performanceScore += float64(elected) / float64(len(vg.Validators)) * 0.06
+	}
+	return performanceScore + float64(elected)*0.02/5.0
+}
+
+func validators(elected, total int) []*model.Validator {
+	vs := make([]*model.Validator, total)
+	for i := range vs {
+		vs[i] = &model.Validator{CurrentlyElected: i < elected}
+	}
+	return vs
+}
+
+func TestScoreV1ReproducesLegacyScore(t *testing.T) {
+	v1, ok := DefaultScoringConfig().active()
+	if !ok || v1.Version != "v1" {
+		t.Fatalf("active default model = %q, want v1", v1.Version)
+	}
+	tests := []struct {
+		name        string
+		vg          *model.ValidatorGroup
+		totalEpochs float64
+	}{
+		{"empty", &model.ValidatorGroup{}, 100},
+		{"perfect", &model.ValidatorGroup{SlashingPenaltyScore: 1, GroupScore: 1, EpochsServed: 100, LockedCeloPercentile: 1, AttestationScore: 1, Validators: validators(5, 5)}, 100},
+		{"typical", &model.ValidatorGroup{SlashingPenaltyScore: 0.98, GroupScore: 0.93, EpochsServed: 180, EpochRegisteredAt: 40, LockedCeloPercentile: 0.42, AttestationScore: 0.87, Validators: validators(3, 4)}, 320},
+		{"registered this epoch", &model.ValidatorGroup{SlashingPenaltyScore: 1, GroupScore: 0.5, EpochRegisteredAt: 320, Validators: validators(0, 2)}, 320},
+		{"more elected than the scale", &model.ValidatorGroup{SlashingPenaltyScore: 0.9, GroupScore: 0.99, EpochsServed: 300, EpochRegisteredAt: 10, Validators: validators(8, 10)}, 320},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := v1.score(tt.vg, tt.totalEpochs)
+			want := legacyPerformanceScore(tt.vg, tt.totalEpochs)
+			if math.Abs(got-want) > 1e-12 {
+				t.Errorf("score() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestScoreWeights(t *testing.T) {
+	vg := &model.ValidatorGroup{SlashingPenaltyScore: 1, GroupScore: 0.5, EpochsServed: 50, EpochRegisteredAt: 50, AttestationScore: 0.25, Validators: validators(2, 4)}
+	tests := []struct {
+		name  string
+		model ScoringModel
+		want  float64
+	}{
+		{"slashing only", ScoringModel{Weights: ScoringWeights{Slashing: 1}}, 1},
+		{"group score only", ScoringModel{Weights: ScoringWeights{GroupScore: 1}}, 0.5},
+		{"history only", ScoringModel{Weights: ScoringWeights{EpochsServedHistory: 1}}, 0.5},
+		{"capacity only", ScoringModel{Weights: ScoringWeights{EpochsServedCapacity: 1}}, 1},
+		{"attestation only", ScoringModel{Weights: ScoringWeights{Attestation: 1}}, 0.25},
+		{"elected ratio only", ScoringModel{Weights: ScoringWeights{ElectedRatio: 1}}, 0.5},
+		{"elected count only", ScoringModel{Weights: ScoringWeights{ElectedCount: 1}, ElectedCountScale: 4}, 0.5},
+		{"elected count without scale", ScoringModel{Weights: ScoringWeights{ElectedCount: 1}}, 0},
+		{"half and half", ScoringModel{Weights: ScoringWeights{Slashing: 0.5, GroupScore: 0.5}}, 0.75},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.model.score(vg, 100); math.Abs(got-tt.want) > 1e-12 {
+				t.Errorf("score() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScoringConfigProblems(t *testing.T) {
+	v1 := DefaultScoringConfig().Models[0]
+	v2 := v1
+	v2.Version = "v2"
+	v2.Weights.Slashing, v2.Weights.GroupScore = 0.4, 0.2
+	with := func(m ScoringModel, change func(m *ScoringModel)) ScoringModel {
+		change(&m)
+		return m
+	}
+
+	tests := []struct {
+		name     string
+		config   ScoringConfig
+		problems []string
+	}{
+		{"default", DefaultScoringConfig(), nil},
+		{"two models", ScoringConfig{Active: "v2", Models: []ScoringModel{v1, v2}}, nil},
+		{"decimal weights", ScoringConfig{Active: "v3", Models: []ScoringModel{{Version: "v3", Weights: ScoringWeights{Slashing: 0.1, GroupScore: 0.2, Attestation: 0.7}}}}, nil},
+		{"weights sum below 1", ScoringConfig{Active: "v1", Models: []ScoringModel{with(v1, func(m *ScoringModel) { m.Weights.Slashing = 0.2 })}},
+			[]string{`weights of scoring model "v1" sum to 0.9`}},
+		{"weights sum above 1", ScoringConfig{Active: "v1", Models: []ScoringModel{with(v1, func(m *ScoringModel) { m.Weights.Slashing = 0.4 })}},
+			[]string{`weights of scoring model "v1" sum to 1.1 instead of 1`}},
+		{"negative weight", ScoringConfig{Active: "v1", Models: []ScoringModel{with(v1, func(m *ScoringModel) { m.Weights.Slashing, m.Weights.GroupScore = -0.1, 0.7 })}},
+			[]string{`scoring model "v1" has a negative weight`}},
+		{"duplicate version", ScoringConfig{Active: "v1", Models: []ScoringModel{v1, v1}},
+			[]string{`scoring model "v1" defined more than once`}},
+		{"missing version", ScoringConfig{Active: "v1", Models: []ScoringModel{v1, with(v2, func(m *ScoringModel) { m.Version = "" })}},
+			[]string{"scoring model without a version"}},
+		{"missing active model", ScoringConfig{Active: "v2", Models: []ScoringModel{v1}},
+			[]string{`active scoring model "v2" isn't defined`}},
+		{"no models", ScoringConfig{Active: "v1"},
+			[]string{`active scoring model "v1" isn't defined`}},
+		{"elected count without scale", ScoringConfig{Active: "v1", Models: []ScoringModel{with(v1, func(m *ScoringModel) { m.ElectedCountScale = 0 })}},
+			[]string{`scoring model "v1" needs a positive elected count scale`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := tt.config.problems()
+			if len(problems) != len(tt.problems) {
+				t.Fatalf("problems() = %q, want %q", problems, tt.problems)
+			}
+			for i, want := range tt.problems {
+				if !strings.Contains(problems[i], want) {
+					t.Errorf("problems()[%d] = %q, want %q", i, problems[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestScoringConfigUnmarshalReplacesModels(t *testing.T) {
+	config := DefaultScoringConfig()
+	err := json.Unmarshal([]byte(`{"active": "v2", "models": [{"version": "v2", "weights": {"slashing": 0.5, "groupScore": 0.5}}]}`), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Models) != 1 || config.Models[0].Version != "v2" || config.Models[0].Weights != (ScoringWeights{Slashing: 0.5, GroupScore: 0.5}) {
+		t.Errorf("models = %+v, want only v2", config.Models)
+	}
+	if problems := config.problems(); len(problems) > 0 {
+		t.Errorf("problems() = %q", problems)
+	}
+
+	config = DefaultScoringConfig()
+	if err := json.Unmarshal([]byte(`{"active": "v1"}`), &config); err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Models) != 1 || config.Models[0] != DefaultScoringConfig().Models[0] {
+		t.Errorf("models = %+v, want the default ones", config.Models)
+	}
+
+	if err := json.Unmarshal([]byte(`{"active": "v1", "model": []}`), &config); err == nil {
+		t.Error("unknown field accepted")
+	}
+}
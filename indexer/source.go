@@ -0,0 +1,104 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+//ChainSource provides the chain data Index needs.
+//ExplorerSource is the production implementation; FixtureSource serves canned data for tests and local runs.
+type ChainSource interface {
+	CurrentEpoch(ctx context.Context) (uint64, error)
+	TargetAPY(ctx context.Context) (string, error)
+	DowntimeScore(ctx context.Context, address string) (string, error)
+	EpochRegistered(ctx context.Context, address string) (EpochVGRegistered, error)
+	ElectedValidatorsAtEpoch(ctx context.Context, epoch uint64) (ElectedValidatorsAtEpoch, error)
+	ValidatorGroups(ctx context.Context) (ValidatorGroupAndValidatorsBasicData, error)
+	GroupDetails(ctx context.Context) (CeloValidatorGroupsAndValidatorsDetails, error)
+	AccountMetadata(ctx context.Context, url string) ([]byte, error)
+}
+
+//FixtureSource is a ChainSource that serves fixed data, keyed by address or epoch where needed.
+type FixtureSource struct {
+	Epoch             uint64                                  `json:"currentEpoch"`
+	TargetApy         string                                  `json:"targetApy"`
+	DowntimeScores    map[string]string                       `json:"downtimeScores"`
+	EpochsRegistered  map[string]EpochVGRegistered            `json:"epochsRegistered"`
+	ElectedValidators map[uint64]ElectedValidatorsAtEpoch     `json:"electedValidators"`
+	Groups            ValidatorGroupAndValidatorsBasicData    `json:"groups"`
+	Details           CeloValidatorGroupsAndValidatorsDetails `json:"details"`
+	Metadata          map[string]json.RawMessage              `json:"metadata"` // By URL.
+}
+
+//LoadFixtureSource reads a FixtureSource from the JSON file at `path`.
+func LoadFixtureSource(path string) (*FixtureSource, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	src := new(FixtureSource)
+	if err := json.NewDecoder(f).Decode(src); err != nil {
+		return nil, fmt.Errorf("fixture %s: %w", path, err)
+	}
+	return src, nil
+}
+
+//CurrentEpoch returns the fixture's current epoch.
+func (s *FixtureSource) CurrentEpoch(ctx context.Context) (uint64, error) {
+	return s.Epoch, nil
+}
+
+//TargetAPY returns the fixture's target yield.
+func (s *FixtureSource) TargetAPY(ctx context.Context) (string, error) {
+	return s.TargetApy, nil
+}
+
+//DowntimeScore returns the fixture's slashing multiplier for `address`.
+func (s *FixtureSource) DowntimeScore(ctx context.Context, address string) (string, error) {
+	score, ok := s.DowntimeScores[address]
+	if !ok {
+		return "", fmt.Errorf("fixture: no downtime score for %s", address)
+	}
+	return score, nil
+}
+
+//EpochRegistered returns the fixture's registration epoch for `address`.
+func (s *FixtureSource) EpochRegistered(ctx context.Context, address string) (EpochVGRegistered, error) {
+	registered, ok := s.EpochsRegistered[address]
+	if !ok {
+		return registered, fmt.Errorf("fixture: no registration epoch for %s", address)
+	}
+	return registered, nil
+}
+
+//ElectedValidatorsAtEpoch returns the fixture's elected Validators for `epoch`.
+func (s *FixtureSource) ElectedValidatorsAtEpoch(ctx context.Context, epoch uint64) (ElectedValidatorsAtEpoch, error) {
+	elected, ok := s.ElectedValidators[epoch]
+	if !ok {
+		return elected, fmt.Errorf("fixture: no elected validators for epoch %d", epoch)
+	}
+	return elected, nil
+}
+
+//ValidatorGroups returns the fixture's ValidatorGroups.
+func (s *FixtureSource) ValidatorGroups(ctx context.Context) (ValidatorGroupAndValidatorsBasicData, error) {
+	return s.Groups, nil
+}
+
+//GroupDetails returns the fixture's ValidatorGroup details.
+func (s *FixtureSource) GroupDetails(ctx context.Context) (CeloValidatorGroupsAndValidatorsDetails, error) {
+	return s.Details, nil
+}
+
+//AccountMetadata returns the fixture's metadata published at `url`.
+func (s *FixtureSource) AccountMetadata(ctx context.Context, url string) ([]byte, error) {
+	metadata, ok := s.Metadata[url]
+	if !ok {
+		return nil, fmt.Errorf("fixture: no metadata at %s", url)
+	}
+	return metadata, nil
+}
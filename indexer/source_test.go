@@ -0,0 +1,60 @@
+package indexer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func loadTestFixtures(t *testing.T) *FixtureSource {
+	t.Helper()
+	src, err := LoadFixtureSource("testdata/fixtures.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return src
+}
+
+func TestLoadFixtureSource(t *testing.T) {
+	src := loadTestFixtures(t)
+	ctx := context.Background()
+
+	epoch, err := src.CurrentEpoch(ctx)
+	if err != nil || epoch != 10 {
+		t.Errorf("CurrentEpoch() = %d, %v, want 10", epoch, err)
+	}
+	groups, err := src.ValidatorGroups(ctx)
+	if err != nil || len(groups.CeloValidatorGroups) != 2 {
+		t.Errorf("ValidatorGroups() = %d groups, %v, want 2", len(groups.CeloValidatorGroups), err)
+	}
+	if _, err := src.ElectedValidatorsAtEpoch(ctx, 7); err == nil {
+		t.Error("ElectedValidatorsAtEpoch(7) succeeded, want an error for an epoch missing from the fixtures")
+	}
+
+	if _, err := LoadFixtureSource("testdata/missing.json"); err == nil {
+		t.Error("LoadFixtureSource() of a missing file succeeded")
+	}
+}
+
+func TestFetchFromFixtures(t *testing.T) {
+	src := loadTestFixtures(t)
+	ctx := context.Background()
+	cfg := DefaultConfig()
+	addresses := []string{"0xgroup1", "0xgroup2", "0xgroup3"}
+
+	scores, errs := fetchDowntimeScores(ctx, src, addresses, cfg)
+	if want := map[string]string{"0xgroup1": "1", "0xgroup2": "0.9"}; !reflect.DeepEqual(scores, want) {
+		t.Errorf("downtime scores = %v, want %v", scores, want)
+	}
+	if len(errs) != 1 || errs["0xgroup3"] == nil {
+		t.Errorf("downtime score errors = %v, want one for 0xgroup3", errs)
+	}
+
+	epochs, errs := fetchEpochsRegistered(ctx, src, addresses, cfg)
+	if want := map[string]EpochVGRegistered{"0xgroup1": {Block: 17281, Epoch: 2}, "0xgroup2": {Block: 138241, Epoch: 9}}; !reflect.DeepEqual(epochs, want) {
+		t.Errorf("registration epochs = %v, want %v", epochs, want)
+	}
+	if len(errs) != 1 || errs["0xgroup3"] == nil {
+		t.Errorf("registration epoch errors = %v, want one for 0xgroup3", errs)
+	}
+}
@@ -12,31 +12,39 @@ type targetApy struct {
 	TargetApy string `json:"target_apy"`
 }
 
-type epochVGRegistered struct {
+//EpochVGRegistered is the block and epoch a ValidatorGroup registered at.
+type EpochVGRegistered struct {
 	Block int
 	Epoch int
 }
 
-type validatorGroupAndValidatorsBasicData struct {
-	CeloValidatorGroups []celoValidatorGroupAndValidatorBasicData `json:"celoValidatorGroups"`
+//ValidatorGroupAndValidatorsBasicData lists every ValidatorGroup with the addresses and names of its Validators.
+type ValidatorGroupAndValidatorsBasicData struct {
+	CeloValidatorGroups []CeloValidatorGroupAndValidatorBasicData `json:"celoValidatorGroups"`
 }
 
-type celoValidatorGroupAndValidatorBasicData struct {
+//CeloValidatorGroupAndValidatorBasicData is a single ValidatorGroup of ValidatorGroupAndValidatorsBasicData.
+type CeloValidatorGroupAndValidatorBasicData struct {
 	Account struct {
 		Address string `json:"address"`
 		Name    string `json:"name"`
 	} `json:"account"`
-	Affiliates struct {
-		Edges []struct {
-			Node struct {
-				Address string `json:"address"`
-				Name    string `json:"name"`
-			} `json:"node"`
-		} `json:"edges"`
-	} `json:"affiliates"`
+	Affiliates AffiliatesBasicData `json:"affiliates"`
 }
 
-type electedValidatorsAtEpoch struct {
+//AffiliatesBasicData is a page of the Validators of a ValidatorGroup, with their addresses and names.
+type AffiliatesBasicData struct {
+	Edges []struct {
+		Node struct {
+			Address string `json:"address"`
+			Name    string `json:"name"`
+		} `json:"node"`
+	} `json:"edges"`
+	PageInfo PageInfo `json:"pageInfo"`
+}
+
+//ElectedValidatorsAtEpoch lists the Validators elected in an epoch, along with their ValidatorGroup.
+type ElectedValidatorsAtEpoch struct {
 	CeloElectedValidators []struct {
 		CeloAccount struct {
 			Address   string `json:"address"`
@@ -49,44 +57,55 @@ type electedValidatorsAtEpoch struct {
 	} `json:"celoElectedValidators"`
 }
 
-type celoValidatorGroupsAndValidatorsDetails struct {
+//CeloValidatorGroupsAndValidatorsDetails holds the current stats of every ValidatorGroup and its Validators.
+type CeloValidatorGroupsAndValidatorsDetails struct {
 	CeloValidatorGroups []struct {
 		Account struct {
-			Address string `json:"address"`
-			Claims  struct {
-				Edges []struct {
-					Node struct {
-						Element  string `json:"element"`
-						Type     string `json:"type"`
-						Verified bool   `json:"verified"`
-					} `json:"node"`
-				} `json:"edges"`
-			} `json:"claims"`
-			Group struct {
+			Address string        `json:"address"`
+			Claims  ClaimsDetails `json:"claims"`
+			Group   struct {
 				Commission      string `json:"commission"`
 				LockedGold      string `json:"lockedGold"`
 				ReceivableVotes string `json:"receivableVotes"`
 				Votes           string `json:"votes"`
 			} `json:"group"`
 			Name string `json:"name"`
+			// URL is where the account's metadata is published, see AccountMetadata.
+			URL string `json:"url"`
 		} `json:"account"`
-		AccumulatedActive  string `json:"accumulatedActive"`
-		AccumulatedRewards string `json:"accumulatedRewards"`
-		Affiliates         struct {
-			Edges []struct {
-				Node struct {
-					Address               string `json:"address"`
-					AttestationsFulfilled int    `json:"attestationsFulfilled"`
-					AttestationsRequested int    `json:"attestationsRequested"`
-					LastElected           int    `json:"lastElected"`
-					Score                 string `json:"score"`
-				} `json:"node"`
-			} `json:"edges"`
-		} `json:"affiliates"`
-		NumMembers int `json:"numMembers"`
+		AccumulatedActive  string            `json:"accumulatedActive"`
+		AccumulatedRewards string            `json:"accumulatedRewards"`
+		Affiliates         AffiliatesDetails `json:"affiliates"`
+		NumMembers         int               `json:"numMembers"`
 	} `json:"celoValidatorGroups"`
 }
 
+//ClaimsDetails is a page of the metadata claims of an account.
+type ClaimsDetails struct {
+	Edges []struct {
+		Node struct {
+			Element  string `json:"element"`
+			Type     string `json:"type"`
+			Verified bool   `json:"verified"`
+		} `json:"node"`
+	} `json:"edges"`
+	PageInfo PageInfo `json:"pageInfo"`
+}
+
+//AffiliatesDetails is a page of the Validators of a ValidatorGroup, with their current stats.
+type AffiliatesDetails struct {
+	Edges []struct {
+		Node struct {
+			Address               string `json:"address"`
+			AttestationsFulfilled int    `json:"attestationsFulfilled"`
+			AttestationsRequested int    `json:"attestationsRequested"`
+			LastElected           int    `json:"lastElected"`
+			Score                 string `json:"score"`
+		} `json:"node"`
+	} `json:"edges"`
+	PageInfo PageInfo `json:"pageInfo"`
+}
+
 // type electedValidators struct {
 // 	Validators []electedValidator
 // }
@@ -1,7 +1,6 @@
 package indexer
 
 import (
-	"math"
 	"math/big"
 
 	"github.com/buidl-labs/celo-voting-validator-backend/graph/model"
@@ -30,19 +29,6 @@ func convertStringToBigFloat(number string) *big.Float {
 	return f
 }
 
-func getEpochFromBlock(block int) uint64 {
-	if block == 0 {
-		return 0
-	}
-
-	epochNumber := uint64(math.Floor(float64(block) / 17280.0))
-	if block%17280 == 0 {
-		return epochNumber
-	} else {
-		return epochNumber + 1
-	}
-}
-
 func calculateCeloPerValidator(celo uint64, num_validators uint) float64 {
 	if celo == 0 || num_validators == 0 {
 		return 0
@@ -76,56 +62,3 @@ func calculateTransparencyScore(vg *model.ValidatorGroup) float64 {
 
 	return transparencyScore
 }
-
-func calculatePerformanceScore(vg *model.ValidatorGroup, totalEpochs float64) float64 {
-	/*
-		SlashingMultiplier(30%)
-		Group Score(30%)
-		EpochsServedHistory(10%)
-		EpochsServedCapacity(10%)
-		LockedceloPercentile(6%)
-		Number of Elected Validators(2%) -> 0.04 * Number of Elected Validators
-		Percentage of Validators Elected(6%) -> (elected validators / total validators) * 0.04
-		Attestation Score(6%)
-	*/
-
-	thirtyPercent := 0.3
-	tenPercent := 0.1
-	sixPercent := 0.06
-	twoPercent := 0.02
-	ZeroPointFourPercent := twoPercent / 5.0
-
-	performanceScore := float64(0)
-	performanceScore += (vg.SlashingPenaltyScore * thirtyPercent)
-	performanceScore += (vg.GroupScore * thirtyPercent)
-
-	epochsServedHistoryPercent := float64(vg.EpochsServed) / float64(totalEpochs)
-	epochsAvailable := totalEpochs - float64(vg.EpochRegisteredAt)
-	var epochsServedHistoryCapacity float64
-	if epochsAvailable == 0 {
-		epochsServedHistoryCapacity = 0.0
-	} else {
-		epochsServedHistoryCapacity = math.Min((float64(vg.EpochsServed) / epochsAvailable), float64(1))
-	}
-
-	performanceScore += (epochsServedHistoryPercent * tenPercent)
-	performanceScore += (epochsServedHistoryCapacity * tenPercent)
-
-	performanceScore += (vg.LockedCeloPercentile * sixPercent)
-	performanceScore += (vg.AttestationScore * sixPercent)
-	numElectedValidators := 0
-	totalValidators := 0
-	for _, v := range vg.Validators {
-		if v.CurrentlyElected {
-			numElectedValidators++
-		}
-		totalValidators++
-	}
-	if totalValidators > 0 {
-		performanceScore += ((float64(numElectedValidators) / float64(totalValidators)) * sixPercent)
-	}
-
-	performanceScore += (float64(numElectedValidators) * ZeroPointFourPercent)
-
-	return performanceScore
-}
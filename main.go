@@ -2,83 +2,254 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/buidl-labs/celo-indexer/indexer"
+	"github.com/buidl-labs/celo-indexer/migrations"
 	"github.com/buidl-labs/celo-voting-validator-backend/graph/database"
-	"github.com/buidl-labs/celo-voting-validator-backend/graph/model"
+	"github.com/go-pg/pg/extra/pgdebug"
 	"github.com/go-pg/pg/v10"
-	"github.com/go-pg/pg/v10/orm"
 	"github.com/joho/godotenv"
 )
 
 func main() {
+	// The first argument selects the command, running without one indexes like before.
+	command, args := "index", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
 
+	// Values from the .env file don't override the ones already in the environment.
 	if err := godotenv.Load(); err != nil {
 		log.Println("Error loading .env file")
 	}
-	DbURL := os.Getenv("DB_URL")
-	if DbURL == "" {
-		log.Fatal("Please provide a DB url.")
+
+	switch command {
+	case "index":
+		daemon := flags.Bool("daemon", false, "Keep running and index on a schedule instead of exiting after one run.")
+		cfg, logger := loadConfig(flags, args, (*indexer.Config).Validate)
+
+		ctx, cancel := signalContext(logger)
+		defer cancel()
+		DB := connectDB(ctx, cfg)
+		defer DB.Close()
+		src := chainSource(cfg)
+		health, err := indexer.NewHealthChecker(DB, cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		serveHTTP(ctx, cfg, health)
+
+		if !*daemon {
+			report, err := indexer.Index(ctx, DB, src, cfg)
+			indexer.LogReport(ctx, report, err)
+			if err != nil {
+				os.Exit(1)
+			}
+			return
+		}
+
+		scheduler, err := indexer.NewScheduler(DB, src, cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		scheduler.Run(ctx)
+
+	case "reindex":
+		from := flags.Uint64("from", 0, "First epoch to reindex.")
+		to := flags.Uint64("to", 0, "Last epoch to reindex, inclusive.")
+		cfg, logger := loadConfig(flags, args, (*indexer.Config).Validate)
+
+		ctx, cancel := signalContext(logger)
+		defer cancel()
+		DB := connectDB(ctx, cfg)
+		defer DB.Close()
+		src := chainSource(cfg)
+
+		report, err := indexer.Reindex(ctx, DB, src, *from, *to, cfg)
+		indexer.LogReport(ctx, report, err)
+		if err != nil {
+			os.Exit(1)
+		}
+
+	case "migrate":
+		flags.Usage = func() {
+			fmt.Fprintf(flags.Output(), "Usage: %s migrate [up|down|status]\n", os.Args[0])
+		}
+		cfg, logger := loadConfig(flags, args, (*indexer.Config).ValidateDatabase)
+
+		ctx, cancel := signalContext(logger)
+		defer cancel()
+		DB := connectDB(ctx, cfg)
+		defer DB.Close()
+
+		if err := migrate(ctx, DB, flags.Arg(0)); err != nil {
+			log.Fatal(err)
+		}
+
+	default:
+		log.Fatalf("Unknown command %q, expected one of: index, reindex, migrate.", command)
 	}
+}
 
-	opts, err := pg.ParseURL(DbURL)
+//loadConfig parses `args` into a Config, exiting if `validate` rejects it, and returns it along with the configured Logger.
+//The standard logger is routed through the Logger too, so that every line has the same format.
+func loadConfig(flags *flag.FlagSet, args []string, validate func(*indexer.Config) error) (*indexer.Config, *indexer.Logger) {
+	cfg, err := indexer.LoadConfig(flags, args)
+	if err == nil {
+		err = validate(cfg)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	DB := database.New(opts)
+	logger := cfg.Logger()
+	log.SetFlags(0)
+	log.SetOutput(logger.Writer())
+	return cfg, logger
+}
 
-	defer DB.Close()
+//serveHTTP serves the metrics and health checks on `cfg.HTTPAddr` in the background, if it's set, until ctx is cancelled.
+func serveHTTP(ctx context.Context, cfg *indexer.Config, health *indexer.HealthChecker) {
+	if cfg.HTTPAddr == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", indexer.MetricsHandler())
+	mux.Handle("/healthz", health.Healthz())
+	mux.Handle("/readyz", health.Readyz())
+	server := &http.Server{Addr: cfg.HTTPAddr, Handler: mux}
 
-	// DB.AddQueryHook(pgdebug.DebugHook{
-	// 	Verbose: true,
-	// })
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+	go func() {
+		log.Println("Serving metrics and health checks on", cfg.HTTPAddr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+}
 
-	ctx := context.Background()
-	if err := DB.Ping(ctx); err != nil {
-		log.Println(err)
+//signalContext returns a context carrying `logger` that's cancelled on SIGINT/SIGTERM, so that a run in progress can stop gracefully.
+func signalContext(logger *indexer.Logger) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(indexer.WithLogger(context.Background(), logger))
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Println("Received", sig, "shutting down...")
+		cancel()
+	}()
+	return ctx, cancel
+}
+
+//connectDB connects to the DB at `cfg.DatabaseURL`, using the schema of the configured network.
+func connectDB(ctx context.Context, cfg *indexer.Config) *pg.DB {
+	// The URL was already checked by Config.Validate.
+	opts, err := pg.ParseURL(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if cfg.DatabasePoolSize > 0 {
+		opts.PoolSize = cfg.DatabasePoolSize
 	}
-	// dropAllTables(DB)
-	// createAllTables(DB)
 
-	indexer.Index(DB)
+	// Each network is stored in its own schema, so that networks can share a DB without a network column.
+	network, ok := cfg.NetworkProfile()
+	if !ok {
+		log.Fatalf("Unknown network %q.", cfg.Network)
+	}
+	// public stays on the path for the extensions installed there, like pgcrypto's gen_random_uuid() before Postgres 13.
+	opts.OnConnect = func(ctx context.Context, conn *pg.Conn) error {
+		_, err := conn.ExecContext(ctx, "SET search_path = ?, public", pg.Ident(network.Schema))
+		return err
+	}
 
-}
+	DB := database.New(opts)
 
-func dropAllTables(DB *pg.DB) {
-	qs := []string{
-		"drop table if exists epochs",
-		"drop table if exists validators",
-		"drop table if exists validator_stats",
-		"drop table if exists validator_groups",
-		"drop table if exists validator_group_stats",
+	if cfg.LogQueries {
+		DB.AddQueryHook(pgdebug.DebugHook{
+			Verbose: true,
+		})
+	}
+	if cfg.SlowQueryThreshold > 0 {
+		DB.AddQueryHook(indexer.SlowQueryHook{Threshold: cfg.SlowQueryThreshold})
 	}
 
-	for _, q := range qs {
-		_, err := DB.Exec(q)
+	if err := DB.Ping(ctx); err != nil {
+		log.Println(err)
+	}
+	if _, err := DB.ExecContext(ctx, "CREATE SCHEMA IF NOT EXISTS ?", pg.Ident(network.Schema)); err != nil {
+		log.Println(err)
+	}
+	log.Printf("Using network %s, stored in schema %q.", network.Name, network.Schema)
+	return DB
+}
+
+//chainSource returns the fixture-backed ChainSource if `cfg.Fixtures` is set, and the explorer otherwise.
+func chainSource(cfg *indexer.Config) indexer.ChainSource {
+	if cfg.Fixtures == "" {
+		src, err := indexer.NewExplorerSource(cfg)
 		if err != nil {
-			panic(err)
+			log.Fatal(err)
 		}
+		return src
+	}
+	src, err := indexer.LoadFixtureSource(cfg.Fixtures)
+	if err != nil {
+		log.Fatal(err)
 	}
+	return src
 }
 
-func createAllTables(DB *pg.DB) {
-	models := []interface{}{
-		(*model.Epoch)(nil),
-		(*model.ValidatorGroup)(nil),
-		(*model.ValidatorGroupStats)(nil),
-		(*model.Validator)(nil),
-		(*model.ValidatorStats)(nil),
-	}
+//migrate applies the pending migrations, reverts the latest one, or lists the pending ones, depending on `direction`.
+func migrate(ctx context.Context, DB *pg.DB, direction string) error {
+	switch direction {
+	case "", "up":
+		applied, err := migrations.Up(ctx, DB)
+		log.Printf("Applied %d migrations.", len(applied))
+		return err
 
-	for _, model := range models {
-		err := DB.Model(model).CreateTable(&orm.CreateTableOptions{
-			Temp: false,
-		})
+	case "down":
+		reverted, err := migrations.Down(ctx, DB)
 		if err != nil {
-			log.Print(err)
+			return err
+		}
+		if reverted == nil {
+			log.Println("No migrations to revert.")
 		}
+		return nil
+
+	case "status":
+		version, err := migrations.Version(ctx, DB)
+		if err != nil {
+			return err
+		}
+		pending, err := migrations.Pending(ctx, DB)
+		if err != nil {
+			return err
+		}
+		log.Printf("Schema version %d, %d pending migrations.", version, len(pending))
+		for _, m := range pending {
+			log.Printf("Pending migration %d: %s", m.Version, m.Name)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown migrate direction %q, expected one of: up, down, status", direction)
 	}
 }
@@ -0,0 +1,133 @@
+//Package migrations keeps the DB schema of the indexer up to date.
+//
+//Every change to the schema is a Migration with a version number. The versions applied to a DB
+//are tracked in the `schema_migrations` table, so Up only runs the ones that are missing.
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+//Migration is a single, versioned change to the schema.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(DB orm.DB) error
+	Down    func(DB orm.DB) error
+}
+
+//schemaMigration is a row of the table tracking the applied migrations.
+type schemaMigration struct {
+	//lint:ignore U1000 `tableName` field is unused, but needed for go-pg
+	tableName struct{}  `pg:"schema_migrations"`
+	Version   int       `pg:",pk"`
+	Name      string    `pg:",notnull"`
+	AppliedAt time.Time `pg:"default:now()"`
+}
+
+//Up applies all the migrations that haven't been applied yet, in order, and returns them.
+//Each migration runs in its own transaction.
+func Up(ctx context.Context, DB *pg.DB) ([]Migration, error) {
+	current, err := Version(ctx, DB)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, m := range all {
+		if m.Version <= current {
+			continue
+		}
+
+		log.Printf("Applying migration %d: %s", m.Version, m.Name)
+		err := DB.RunInTransaction(ctx, func(tx *pg.Tx) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			_, err := tx.Model(&schemaMigration{Version: m.Version, Name: m.Name}).Insert()
+			return err
+		})
+		if err != nil {
+			return applied, fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		applied = append(applied, m)
+	}
+	return applied, nil
+}
+
+//Down reverts the latest applied migration and returns it, or nil if there's nothing to revert.
+func Down(ctx context.Context, DB *pg.DB) (*Migration, error) {
+	current, err := Version(ctx, DB)
+	if err != nil {
+		return nil, err
+	}
+	if current == 0 {
+		return nil, nil
+	}
+
+	for i := range all {
+		m := all[i]
+		if m.Version != current {
+			continue
+		}
+
+		log.Printf("Reverting migration %d: %s", m.Version, m.Name)
+		err := DB.RunInTransaction(ctx, func(tx *pg.Tx) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			_, err := tx.Model((*schemaMigration)(nil)).Where("version = ?", m.Version).Delete()
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		return &m, nil
+	}
+	return nil, fmt.Errorf("migration %d is applied, but unknown to this binary", current)
+}
+
+//Version returns the version of the latest applied migration, or 0 if none has been applied.
+func Version(ctx context.Context, DB *pg.DB) (int, error) {
+	err := DB.ModelContext(ctx, (*schemaMigration)(nil)).CreateTable(&orm.CreateTableOptions{
+		IfNotExists: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var version int
+	_, err = DB.QueryOneContext(ctx, pg.Scan(&version), "SELECT coalesce(max(version), 0) FROM schema_migrations")
+	return version, err
+}
+
+//Pending returns the migrations that haven't been applied yet.
+func Pending(ctx context.Context, DB *pg.DB) ([]Migration, error) {
+	current, err := Version(ctx, DB)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, m := range all {
+		if m.Version > current {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+func exec(DB orm.DB, queries ...string) error {
+	for _, q := range queries {
+		if _, err := DB.Exec(q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
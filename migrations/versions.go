@@ -0,0 +1,228 @@
+package migrations
+
+import "github.com/go-pg/pg/v10/orm"
+
+//all is every migration, ordered by version. New migrations go at the end, with the next version.
+//Applied migrations must never be edited, add a new one instead. The DDL of every migration is spelled out rather than
+//generated from the models of package indexer, so that changing a model doesn't change what a migration does.
+var all = []Migration{
+	{
+		Version: 1,
+		Name:    "create tables",
+		// Tables are created only if they don't exist, so DBs set up before migrations existed can be migrated too.
+		// The DDL is what go-pg generated from the models of the backend when this migration was written. It's spelled out
+		// so that it doesn't change with the models, which live in another module and can change with its version.
+		Up: func(DB orm.DB) error {
+			return exec(DB,
+				`CREATE TABLE IF NOT EXISTS "epochs" (
+					"id" text DEFAULT gen_random_uuid(),
+					"start_block" bigint UNIQUE,
+					"end_block" bigint UNIQUE,
+					"number" bigint UNIQUE,
+					"created_at" timestamptz DEFAULT now(),
+					PRIMARY KEY ("id"),
+					UNIQUE ("start_block", "end_block", "number")
+				)`,
+				`CREATE TABLE IF NOT EXISTS "validator_groups" (
+					"id" text DEFAULT gen_random_uuid(),
+					"address" text NOT NULL UNIQUE,
+					"name" text UNIQUE,
+					"email" text UNIQUE,
+					"website_url" text UNIQUE,
+					"discord_tag" text UNIQUE,
+					"twitter_username" text UNIQUE,
+					"verified_dns" boolean,
+					"geographic_location" text,
+					"created_at" timestamptz DEFAULT now(),
+					"group_share" double precision,
+					"epoch_registered_at" bigint,
+					"epochs_served" bigint DEFAULT 0,
+					"currently_elected" boolean DEFAULT false,
+					"recieved_votes" bigint,
+					"available_votes" bigint,
+					"group_score" double precision,
+					"locked_celo" bigint,
+					"locked_celo_percentile" double precision,
+					"slashing_penalty_score" double precision,
+					"attestation_score" double precision,
+					"estimated_apy" double precision,
+					"transparency_score" double precision,
+					"performance_score" double precision,
+					PRIMARY KEY ("id"),
+					UNIQUE ("address", "name", "email", "website_url", "discord_tag", "twitter_username")
+				)`,
+				`CREATE TABLE IF NOT EXISTS "validator_group_stats" (
+					"id" text DEFAULT gen_random_uuid(),
+					"locked_celo" bigint,
+					"group_share" double precision,
+					"votes" bigint,
+					"voting_cap" bigint,
+					"attestation_percentage" double precision,
+					"slashing_score" double precision,
+					"group_score" double precision,
+					"epoch_id" text,
+					"validator_group_id" text,
+					"created_at" timestamptz DEFAULT now(),
+					"estimated_apy" double precision,
+					PRIMARY KEY ("id")
+				)`,
+				`CREATE TABLE IF NOT EXISTS "validators" (
+					"id" text DEFAULT gen_random_uuid(),
+					"address" text NOT NULL UNIQUE,
+					"name" text UNIQUE,
+					"created_at" timestamptz DEFAULT now(),
+					"currently_elected" boolean,
+					"validator_group_id" text,
+					PRIMARY KEY ("id"),
+					UNIQUE ("address", "name")
+				)`,
+				`CREATE TABLE IF NOT EXISTS "validator_stats" (
+					"id" text DEFAULT gen_random_uuid(),
+					"attestations_requested" bigint,
+					"attestations_fulfilled" bigint,
+					"last_elected" bigint,
+					"score" double precision,
+					"epoch_id" text,
+					"validator_id" text,
+					"created_at" timestamptz DEFAULT now(),
+					PRIMARY KEY ("id")
+				)`,
+				`CREATE TABLE IF NOT EXISTS "elections" (
+					"id" text DEFAULT gen_random_uuid(),
+					"epoch_number" bigint NOT NULL,
+					"validator_address" text NOT NULL,
+					"group_address" text NOT NULL,
+					"created_at" timestamptz DEFAULT now(),
+					PRIMARY KEY ("id"),
+					UNIQUE ("epoch_number", "validator_address")
+				)`,
+			)
+		},
+		Down: func(DB orm.DB) error {
+			return exec(DB,
+				"DROP TABLE IF EXISTS elections",
+				"DROP TABLE IF EXISTS validator_stats",
+				"DROP TABLE IF EXISTS validators",
+				"DROP TABLE IF EXISTS validator_group_stats",
+				"DROP TABLE IF EXISTS validator_groups",
+				"DROP TABLE IF EXISTS epochs",
+			)
+		},
+	},
+	{
+		Version: 2,
+		Name:    "add indexes",
+		Up: func(DB orm.DB) error {
+			return exec(DB,
+				"CREATE INDEX IF NOT EXISTS validators_validator_group_id_idx ON validators (validator_group_id)",
+				// Kept for migrated DBs, `findLastIndexedEpoch` used to order by `created_at`.
+				"CREATE INDEX IF NOT EXISTS epochs_created_at_idx ON epochs (created_at)",
+				"CREATE INDEX IF NOT EXISTS elections_group_address_idx ON elections (group_address)",
+				// One snapshot of stats per epoch, see `upsertValidatorStats` and `upsertValidatorGroupStats`.
+				"CREATE UNIQUE INDEX IF NOT EXISTS validator_stats_epoch_id_validator_id_idx ON validator_stats (epoch_id, validator_id)",
+				"CREATE UNIQUE INDEX IF NOT EXISTS validator_group_stats_epoch_id_validator_group_id_idx ON validator_group_stats (epoch_id, validator_group_id)",
+			)
+		},
+		Down: func(DB orm.DB) error {
+			return exec(DB,
+				"DROP INDEX IF EXISTS validator_group_stats_epoch_id_validator_group_id_idx",
+				"DROP INDEX IF EXISTS validator_stats_epoch_id_validator_id_idx",
+				"DROP INDEX IF EXISTS elections_group_address_idx",
+				"DROP INDEX IF EXISTS epochs_created_at_idx",
+				"DROP INDEX IF EXISTS validators_validator_group_id_idx",
+			)
+		},
+	},
+	{
+		Version: 3,
+		Name:    "create memberships",
+		Up: func(DB orm.DB) error {
+			return exec(DB,
+				`CREATE TABLE IF NOT EXISTS "memberships" (
+					"id" text DEFAULT gen_random_uuid(),
+					"validator_address" text NOT NULL,
+					"group_address" text NOT NULL,
+					"joined_epoch" bigint NOT NULL,
+					"left_epoch" bigint,
+					"created_at" timestamptz DEFAULT now(),
+					PRIMARY KEY ("id")
+				)`,
+				// A Validator has at most one current Membership per ValidatorGroup.
+				"CREATE UNIQUE INDEX IF NOT EXISTS memberships_current_idx ON memberships (group_address, validator_address) WHERE left_epoch IS NULL",
+				"CREATE INDEX IF NOT EXISTS memberships_validator_address_idx ON memberships (validator_address)",
+			)
+		},
+		Down: func(DB orm.DB) error {
+			return exec(DB, "DROP TABLE IF EXISTS memberships")
+		},
+	},
+	{
+		Version: 4,
+		Name:    "create validator moves",
+		Up: func(DB orm.DB) error {
+			return exec(DB,
+				`CREATE TABLE IF NOT EXISTS "validator_moves" (
+					"id" text DEFAULT gen_random_uuid(),
+					"validator_address" text NOT NULL,
+					"from_group_address" text,
+					"to_group_address" text NOT NULL,
+					"epoch" bigint NOT NULL,
+					"created_at" timestamptz DEFAULT now(),
+					PRIMARY KEY ("id")
+				)`,
+				"CREATE INDEX IF NOT EXISTS validator_moves_validator_address_idx ON validator_moves (validator_address)",
+			)
+		},
+		Down: func(DB orm.DB) error {
+			return exec(DB, "DROP TABLE IF EXISTS validator_moves")
+		},
+	},
+	{
+		Version: 5,
+		Name:    "create account metadata",
+		Up: func(DB orm.DB) error {
+			return exec(DB,
+				`CREATE TABLE IF NOT EXISTS "account_metadata" (
+					"id" text DEFAULT gen_random_uuid(),
+					"address" text NOT NULL UNIQUE,
+					"url" text NOT NULL,
+					"keybase" text,
+					"twitter" text,
+					"discord" text,
+					"email" text,
+					"location" text,
+					"last_verified" timestamptz NOT NULL,
+					"created_at" timestamptz DEFAULT now(),
+					PRIMARY KEY ("id"),
+					UNIQUE ("address")
+				)`,
+			)
+		},
+		Down: func(DB orm.DB) error {
+			return exec(DB, "DROP TABLE IF EXISTS account_metadata")
+		},
+	},
+	{
+		Version: 6,
+		Name:    "create performance scores",
+		Up: func(DB orm.DB) error {
+			return exec(DB,
+				`CREATE TABLE IF NOT EXISTS "performance_scores" (
+					"id" text DEFAULT gen_random_uuid(),
+					"epoch_number" bigint NOT NULL,
+					"group_address" text NOT NULL,
+					"model_version" text NOT NULL,
+					"score" double precision NOT NULL,
+					"active" boolean NOT NULL,
+					"created_at" timestamptz DEFAULT now(),
+					PRIMARY KEY ("id"),
+					UNIQUE ("epoch_number", "group_address", "model_version")
+				)`,
+				"CREATE INDEX IF NOT EXISTS performance_scores_group_address_idx ON performance_scores (group_address)",
+			)
+		},
+		Down: func(DB orm.DB) error {
+			return exec(DB, "DROP TABLE IF EXISTS performance_scores")
+		},
+	},
+}